@@ -0,0 +1,146 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// AccelerationProfile gives the pointer speed while movement keys are held
+type AccelerationProfile interface {
+	// Speed returns the speed in px/s after the keys have been held for the
+	// given number of seconds
+	Speed(held float64) float64
+}
+
+// fullSpeed is the speed a profile settles at, used for analog input
+func fullSpeed(p AccelerationProfile) float64 {
+	return p.Speed(math.Inf(1))
+}
+
+// constantProfile moves at one speed from the start
+type constantProfile float64
+
+func (p constantProfile) Speed(held float64) float64 {
+	return float64(p)
+}
+
+// rampProfile goes from initial to max speed over ramp seconds, shaped by ease
+type rampProfile struct {
+	initial, max, ramp float64
+	// ease maps the fraction of the ramp done (0..1) to the fraction of the speed gained
+	ease func(t float64) float64
+}
+
+func (p rampProfile) Speed(held float64) float64 {
+	if p.ramp <= 0 || held >= p.ramp {
+		return p.max
+	}
+	t := math.Max(held, 0) / p.ramp
+	return p.initial + (p.max-p.initial)*p.ease(t)
+}
+
+// stepsProfile switches speed at fixed times, sorted by after
+type stepsProfile []speedStep
+
+func (p stepsProfile) Speed(held float64) float64 {
+	speed := p[0].speed
+	for _, step := range p[1:] {
+		if held < step.after {
+			break
+		}
+		speed = step.speed
+	}
+	return speed
+}
+
+type speedStep struct {
+	after, speed float64 // seconds, px/s
+}
+
+// exponentialEase grows the speed by the same factor every moment, so the
+// start stays slow for longer than a linear ramp
+func exponentialEase(initial, max float64) func(t float64) float64 {
+	r := max / initial
+	if r == 1 {
+		return func(t float64) float64 { return t }
+	}
+	return func(t float64) float64 { return (math.Pow(r, t) - 1) / (r - 1) }
+}
+
+// bezierEase is a CSS-style cubic-bezier timing function through
+// (0,0), (x1,y1), (x2,y2) and (1,1)
+func bezierEase(x1, y1, x2, y2 float64) func(t float64) float64 {
+	bezier := func(a, b, s float64) float64 {
+		return 3*a*s*(1-s)*(1-s) + 3*b*s*s*(1-s) + s*s*s
+	}
+	return func(t float64) float64 {
+		// x is monotonic for x1, x2 in 0..1, so bisect for the s giving t
+		lo, hi := 0.0, 1.0
+		for range 30 {
+			s := (lo + hi) / 2
+			if bezier(x1, x2, s) < t {
+				lo = s
+			} else {
+				hi = s
+			}
+		}
+		return bezier(y1, y2, (lo+hi)/2)
+	}
+}
+
+// newAccelerationProfile builds the profile described by a config entry
+func newAccelerationProfile(cfg ProfileConfig) (AccelerationProfile, error) {
+	ramp := cfg.RampTime / 1000
+
+	switch cfg.Kind {
+	case "constant":
+		if cfg.MaxSpeed <= 0 {
+			return nil, errors.New("maxSpeed must be positive")
+		}
+		return constantProfile(cfg.MaxSpeed), nil
+	case "linear", "exponential", "bezier":
+		if cfg.InitialSpeed <= 0 || cfg.MaxSpeed <= 0 {
+			return nil, errors.New("initialSpeed and maxSpeed must be positive")
+		}
+		if ramp < 0 {
+			return nil, errors.New("rampTime can't be negative")
+		}
+		p := rampProfile{initial: cfg.InitialSpeed, max: cfg.MaxSpeed, ramp: ramp}
+		switch cfg.Kind {
+		case "linear":
+			p.ease = func(t float64) float64 { return t }
+		case "exponential":
+			p.ease = exponentialEase(cfg.InitialSpeed, cfg.MaxSpeed)
+		default:
+			curve := cfg.Curve
+			if curve == nil {
+				curve = []float64{0.42, 0, 0.58, 1} // ease-in-out
+			}
+			if len(curve) != 4 || curve[0] < 0 || curve[0] > 1 || curve[2] < 0 || curve[2] > 1 {
+				return nil, errors.New("curve must be [x1, y1, x2, y2] with x1 and x2 in 0..1")
+			}
+			p.ease = bezierEase(curve[0], curve[1], curve[2], curve[3])
+		}
+		return p, nil
+	case "steps":
+		if len(cfg.Steps) == 0 {
+			return nil, errors.New("steps is empty")
+		}
+		var p stepsProfile
+		for _, step := range cfg.Steps {
+			if step.Speed <= 0 {
+				return nil, errors.New("step speeds must be positive")
+			}
+			p = append(p, speedStep{after: step.After / 1000, speed: step.Speed})
+		}
+		if !slices.IsSortedFunc(p, func(a, b speedStep) int { return cmp.Compare(a.after, b.after) }) {
+			return nil, errors.New("steps must be sorted by after")
+		}
+		return p, nil
+	default:
+		return nil, fmt.Errorf("unknown kind %q (constant, linear, exponential, bezier or steps)", cfg.Kind)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// backendCandidate is one way of getting keyboard input or driving the pointer
+type backendCandidate[T any] struct {
+	name string
+	// degraded says why the candidate only half works in this session.
+	// Auto-detection tries it after every other candidate has failed.
+	degraded string
+	open     func() (T, error)
+}
+
+// chooseBackend opens the first usable candidate, or only the one named by
+// force, logging why each candidate before it was rejected
+func chooseBackend[T any](kind string, candidates []backendCandidate[T], force string) (T, error) {
+	var zero T
+	if force != "" {
+		var names []string
+		for _, c := range candidates {
+			if c.name != force {
+				names = append(names, c.name)
+				continue
+			}
+			backend, err := c.open()
+			if err != nil {
+				return zero, fmt.Errorf("%s %s: %v", force, kind, err)
+			}
+			if c.degraded != "" {
+				fmt.Printf("Using %s %s, though %s\n", c.name, kind, c.degraded)
+				return backend, nil
+			}
+			fmt.Printf("Using %s %s\n", c.name, kind)
+			return backend, nil
+		}
+		return zero, fmt.Errorf("unknown %s %q (available: %s)", kind, force, strings.Join(names, ", "))
+	}
+
+	var fallbacks []backendCandidate[T]
+	for _, c := range candidates {
+		if c.degraded != "" {
+			fmt.Printf("Skipping %s %s for now: %s\n", c.name, kind, c.degraded)
+			fallbacks = append(fallbacks, c)
+			continue
+		}
+		backend, err := c.open()
+		if err != nil {
+			fmt.Printf("Skipping %s %s: %v\n", c.name, kind, err)
+			continue
+		}
+		fmt.Printf("Using %s %s\n", c.name, kind)
+		return backend, nil
+	}
+	for _, c := range fallbacks {
+		backend, err := c.open()
+		if err != nil {
+			fmt.Printf("Skipping %s %s: %v\n", c.name, kind, err)
+			continue
+		}
+		fmt.Printf("Falling back to %s %s: %s\n", c.name, kind, c.degraded)
+		return backend, nil
+	}
+	return zero, fmt.Errorf("no usable %s", kind)
+}
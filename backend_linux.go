@@ -0,0 +1,146 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/go-vgo/robotgo"
+	"github.com/jezek/xgb"
+)
+
+// linuxSession describes the graphical session we were started in
+type linuxSession struct {
+	sessionType    string // XDG_SESSION_TYPE
+	display        string
+	waylandDisplay string
+}
+
+// currentSession probes the environment once and logs what it found
+var currentSession = sync.OnceValue(func() linuxSession {
+	s := linuxSession{
+		sessionType:    os.Getenv("XDG_SESSION_TYPE"),
+		display:        os.Getenv("DISPLAY"),
+		waylandDisplay: os.Getenv("WAYLAND_DISPLAY"),
+	}
+	fmt.Printf("Session: XDG_SESSION_TYPE=%q WAYLAND_DISPLAY=%q DISPLAY=%q\n", s.sessionType, s.waylandDisplay, s.display)
+	return s
+})
+
+func (s linuxSession) wayland() bool {
+	return s.sessionType == "wayland" || s.waylandDisplay != ""
+}
+
+// keyboardHookCandidates lists the keyboard hooks to try, best first
+func keyboardHookCandidates() []backendCandidate[KeyboardHook] {
+	session := currentSession()
+
+	x11 := backendCandidate[KeyboardHook]{name: "x11", open: func() (KeyboardHook, error) {
+		if err := checkX11(session); err != nil {
+			return nil, err
+		}
+		return NewX11KeyboardHook(""), nil
+	}}
+	if session.wayland() {
+		x11.degraded = "under Wayland X11 grabs only see keys typed into Xwayland windows"
+	}
+
+	evdev := backendCandidate[KeyboardHook]{name: "evdev", open: func() (KeyboardHook, error) {
+		devices, err := openKeyboardDevices()
+		for _, dev := range devices {
+			dev.file.Close()
+		}
+		// With nothing else to fall back to, wait for a keyboard to be plugged in
+		if err != nil && !(errors.Is(err, errNoKeyboard) && session.display == "") {
+			return nil, err
+		}
+		return NewLinuxKeyboardHook(), nil
+	}}
+	// Without uinput the keyboards can't be grabbed, so mapped keys leak
+	// through; the X11 hook keeps them from the focused app
+	if err := checkUinput(); err != nil {
+		evdev.degraded = fmt.Sprintf("mapped keys will also reach the focused app: %v", err)
+	}
+
+	return []backendCandidate[KeyboardHook]{evdev, x11}
+}
+
+// pointerCandidates lists the pointer backends to try, best first
+func pointerCandidates() []backendCandidate[PointerBackend] {
+	session := currentSession()
+
+	uinput := backendCandidate[PointerBackend]{name: "uinput", open: func() (PointerBackend, error) {
+		if err := checkUinput(); err != nil {
+			return nil, err
+		}
+		return newUinputPointer(session)
+	}}
+	xtest := backendCandidate[PointerBackend]{name: "xtest", open: func() (PointerBackend, error) {
+		if err := checkX11(session); err != nil {
+			return nil, err
+		}
+		return newXTestPointer("")
+	}}
+	robotgoCandidate := backendCandidate[PointerBackend]{name: "robotgo", open: func() (PointerBackend, error) {
+		if err := checkX11(session); err != nil {
+			return nil, err
+		}
+		return robotgoPointer{}, nil
+	}}
+
+	if session.wayland() {
+		xtest.degraded = "under Wayland XTest only moves the pointer over Xwayland windows"
+		robotgoCandidate.degraded = "robotgo can't move the pointer under Wayland"
+		return []backendCandidate[PointerBackend]{uinput, xtest, robotgoCandidate}
+	}
+	// Relative uinput motion gets pointer acceleration, XTest lands exactly
+	return []backendCandidate[PointerBackend]{xtest, uinput, robotgoCandidate}
+}
+
+// checkX11 reports whether the X server can be reached
+func checkX11(session linuxSession) error {
+	if session.display == "" {
+		return errors.New("DISPLAY is not set")
+	}
+	conn, err := xgb.NewConnDisplay("")
+	if err != nil {
+		return fmt.Errorf("failed to connect to X display %s: %v", session.display, err)
+	}
+	conn.Close()
+	return nil
+}
+
+// checkUinput reports whether we may create virtual devices
+func checkUinput() error {
+	if err := syscall.Access(uinputPath, 2 /* W_OK */); err != nil {
+		return fmt.Errorf("%s is not writable: %v (add a udev rule or join the 'input' group)", uinputPath, err)
+	}
+	return nil
+}
+
+// newUinputPointer creates the virtual mouse, and the tablet for exact warps
+// when the screen size is known
+func newUinputPointer(session linuxSession) (PointerBackend, error) {
+	mouse, err := newUinputMouse()
+	if err != nil {
+		return nil, err
+	}
+
+	// Compositors map absolute devices onto the whole screen layout, whose
+	// size Xwayland reports through robotgo
+	if checkX11(session) != nil {
+		fmt.Println("No X display to read the screen size from, pointer warps won't work")
+		return mouse, nil
+	}
+	if width, height := robotgo.GetScreenSize(); width > 0 && height > 0 {
+		mouse.tablet, err = newUinputTablet(width, height)
+		if err != nil {
+			fmt.Printf("Virtual tablet unavailable, pointer warps won't work: %v\n", err)
+		}
+	}
+	return mouse, nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+// keyboardHookCandidates lists the keyboard hooks to try, best first
+func keyboardHookCandidates() []backendCandidate[KeyboardHook] {
+	return []backendCandidate[KeyboardHook]{
+		{name: "native", open: func() (KeyboardHook, error) { return NewKeyboardHook(), nil }},
+	}
+}
+
+// pointerCandidates lists the pointer backends to try, best first
+func pointerCandidates() []backendCandidate[PointerBackend] {
+	return []backendCandidate[PointerBackend]{
+		{name: "robotgo", open: func() (PointerBackend, error) { return robotgoPointer{}, nil }},
+	}
+}
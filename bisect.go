@@ -0,0 +1,67 @@
+package main
+
+import "math"
+
+// region is an area of the screen in bisection mode
+type region struct {
+	x, y, width, height float64
+}
+
+// bisectCutThreshold is how far along an axis a movement key has to point
+// to cut that axis, so a key a little off vertical still only cuts vertically
+var bisectCutThreshold = math.Sin(math.Pi / 8)
+
+// toggleBisect enters bisection mode with the monitor under the pointer as
+// the region, or leaves it; the caller holds mc.mu
+func (mc *MouseController) toggleBisect() {
+	if mc.bisecting {
+		mc.bisecting = false
+		mc.bisectHistory = nil
+		return
+	}
+
+	x, y := mc.pointer.Location()
+	m := monitorAt(listMonitors(mc.pointer), x, y)
+	mc.bisecting = true
+	mc.bisectRegion = region{float64(m.X), float64(m.Y), float64(m.Width), float64(m.Height)}
+	mc.bisectHistory = nil
+	mc.centerOnRegion()
+}
+
+// bisect halves the region toward a direction: a diagonal cuts it to a
+// quarter; the caller holds mc.mu
+func (mc *MouseController) bisect(dx, dy float64) {
+	r := mc.bisectRegion
+	if math.Abs(dx) >= bisectCutThreshold {
+		r.width /= 2
+		if dx > 0 {
+			r.x += r.width
+		}
+	}
+	if math.Abs(dy) >= bisectCutThreshold {
+		r.height /= 2
+		if dy > 0 {
+			r.y += r.height
+		}
+	}
+
+	mc.bisectHistory = append(mc.bisectHistory, mc.bisectRegion)
+	mc.bisectRegion = r
+	mc.centerOnRegion()
+}
+
+// undoBisect goes back to the region before the last cut; the caller holds mc.mu
+func (mc *MouseController) undoBisect() {
+	if len(mc.bisectHistory) == 0 {
+		return
+	}
+	mc.bisectRegion = mc.bisectHistory[len(mc.bisectHistory)-1]
+	mc.bisectHistory = mc.bisectHistory[:len(mc.bisectHistory)-1]
+	mc.centerOnRegion()
+}
+
+// centerOnRegion warps the pointer to the middle of the region
+func (mc *MouseController) centerOnRegion() {
+	r := mc.bisectRegion
+	mc.WarpTo(int(r.x+r.width/2), int(r.y+r.height/2))
+}
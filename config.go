@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config holds the user settings read from the config file
+type Config struct {
+	// Devices pins the keyboards to use (Linux evdev) by name, vendor:product or path.
+	// When empty, every device with letter keys is used.
+	Devices []string `json:"devices,omitempty"`
+
+	// IndicatorLED lights a keyboard LED ("caps", "scroll" or "num") while
+	// mouse mode is active. Linux evdev only; empty disables it.
+	IndicatorLED string `json:"indicatorLed,omitempty"`
+
+	// Buttons binds letter, digit, Tab and Backspace keys without an action of
+	// their own to mouse buttons by number (8 is back, 9 forward, up to 12),
+	// held while the key is
+	Buttons map[string]int `json:"buttons,omitempty"`
+
+	// Directions binds letter, digit, Tab and Backspace keys without an
+	// action of their own to extra movement directions
+	Directions map[string]DirectionConfig `json:"directions,omitempty"`
+
+	// Precision and Turbo scale the pointer speed while their key is held
+	Precision SpeedKeyConfig `json:"precision"`
+	Turbo     SpeedKeyConfig `json:"turbo"`
+
+	Bisect  BisectConfig  `json:"bisect"`
+	Inertia InertiaConfig `json:"inertia"`
+	Nudge   NudgeConfig   `json:"nudge"`
+
+	// SOCD settles movement keys held in opposite directions: "neutral"
+	// stops on that axis, "last" or "first" lets the last or first pressed win
+	SOCD string `json:"socd"`
+
+	// SpeedScale adjusts speeds to the monitor under the pointer: "none",
+	// "resolution" (by its height) or "dpi" (by its pixel density)
+	SpeedScale string `json:"speedScale"`
+
+	// TickInterval is how often the pointer is moved, in milliseconds.
+	// Speeds are per second, so a shorter interval only makes motion smoother.
+	TickInterval float64 `json:"tickInterval"`
+
+	Acceleration AccelerationConfig `json:"acceleration"`
+	Scroll       ScrollConfig       `json:"scroll"`
+	Gamepad      GamepadConfig      `json:"gamepad"`
+
+	// The keys and vectors of Directions, filled in by loadConfig
+	directionKeys map[string]Key
+	directions    map[Key]direction
+}
+
+// DirectionConfig is a movement direction, given as an X, Y vector (Y
+// pointing down) or, when both are 0, as an angle
+type DirectionConfig struct {
+	// Angle is in degrees clockwise from straight up
+	Angle float64 `json:"angle"`
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+}
+
+// SpeedKeyConfig binds a letter, digit, "tab" or "backspace" key that
+// scales the speed while held. An empty key disables it.
+type SpeedKeyConfig struct {
+	Key   string  `json:"key"`
+	Scale float64 `json:"scale"`
+}
+
+// BisectConfig sets the keys of bisection mode, where each movement key
+// halves the region the pointer is in. An empty key disables it.
+type BisectConfig struct {
+	// Key enters and leaves the mode
+	Key string `json:"key"`
+	// UndoKey takes back the last cut
+	UndoKey string `json:"undoKey"`
+}
+
+// InertiaConfig keeps the pointer gliding after the movement keys are released
+type InertiaConfig struct {
+	Enabled bool `json:"enabled"`
+	// Friction is how quickly a glide slows down: its speed drops to about
+	// a third every 1/Friction seconds
+	Friction float64 `json:"friction"`
+}
+
+// NudgeConfig makes a quick tap of a movement key move an exact distance
+type NudgeConfig struct {
+	// Distance is moved by a tap, in pixels; 0 turns nudging off
+	Distance int `json:"distance"`
+	// HoldTime is how long a key is held, in milliseconds, before it moves
+	// continuously instead
+	HoldTime float64 `json:"holdTime"`
+}
+
+func (c NudgeConfig) holdTime() time.Duration {
+	return time.Duration(c.HoldTime * float64(time.Millisecond))
+}
+
+// AccelerationConfig lists the speed profiles offered in the tray menu
+type AccelerationConfig struct {
+	// Profile names the profile used at startup, Normal or else the first one
+	Profile  string          `json:"profile,omitempty"`
+	Profiles []ProfileConfig `json:"profiles,omitempty"`
+}
+
+// ProfileConfig describes an AccelerationProfile. Speeds are in px/s and
+// times in milliseconds.
+type ProfileConfig struct {
+	Name string `json:"name"`
+	// Kind is constant, linear, exponential, bezier or steps
+	Kind         string  `json:"kind"`
+	InitialSpeed float64 `json:"initialSpeed,omitempty"`
+	MaxSpeed     float64 `json:"maxSpeed,omitempty"`
+	RampTime     float64 `json:"rampTime,omitempty"`
+	// Curve holds the bezier control points x1, y1, x2, y2; ease-in-out when empty
+	Curve []float64 `json:"curve,omitempty"`
+	// Steps is the speed table for the steps kind
+	Steps []SpeedStepConfig `json:"steps,omitempty"`
+}
+
+// SpeedStepConfig switches to Speed once the keys have been held After ms
+type SpeedStepConfig struct {
+	After float64 `json:"after"`
+	Speed float64 `json:"speed"`
+}
+
+// defaultProfiles are the tray speed presets: the same ease-in-out ramp at
+// 50%, 75%, 100% and 150%
+func defaultProfiles() []ProfileConfig {
+	var profiles []ProfileConfig
+	for _, preset := range []struct {
+		name  string
+		scale float64
+	}{{"Slow", 0.5}, {"Medium", 0.75}, {"Normal", 1}, {"Fast", 1.5}} {
+		profiles = append(profiles, ProfileConfig{
+			Name:         preset.name,
+			Kind:         "bezier",
+			InitialSpeed: slowSpeed * preset.scale,
+			MaxSpeed:     normalSpeed * preset.scale,
+			RampTime:     300,
+		})
+	}
+	return profiles
+}
+
+// profile builds the named profile
+func (c *AccelerationConfig) profile(name string) (AccelerationProfile, error) {
+	for _, p := range c.Profiles {
+		if p.Name == name {
+			return newAccelerationProfile(p)
+		}
+	}
+	return nil, fmt.Errorf("no profile named %q", name)
+}
+
+// ScrollConfig controls the scroll keys. Amounts are in wheel notches.
+type ScrollConfig struct {
+	// Step is scrolled as soon as a scroll key goes down
+	Step float64 `json:"step"`
+	// InitialSpeed is the scroll rate in notches per second right after the key goes down
+	InitialSpeed float64 `json:"initialSpeed"`
+	// Speed is the rate reached after holding the key for RampTime milliseconds
+	Speed    float64 `json:"speed"`
+	RampTime float64 `json:"rampTime"`
+}
+
+// GamepadConfig controls the gamepad / joystick input source
+type GamepadConfig struct {
+	Enabled bool `json:"enabled"`
+	// Device selects the controller like Devices does; empty picks the first one found
+	Device string `json:"device,omitempty"`
+	// Deadzone is the fraction of stick travel (0..1) that is ignored around the center
+	Deadzone float64 `json:"deadzone"`
+	// Curve is the response exponent: 1 is linear, higher values give finer control near the center
+	Curve float64 `json:"curve"`
+}
+
+// DefaultConfig returns the settings used when no config file exists
+func DefaultConfig() *Config {
+	return &Config{
+		TickInterval: 16,
+		Precision:    SpeedKeyConfig{Key: "tab", Scale: 0.2},
+		Turbo:        SpeedKeyConfig{Key: "1", Scale: 3},
+		Bisect:       BisectConfig{Key: "b", UndoKey: "backspace"},
+		Inertia:      InertiaConfig{Friction: 4},
+		Nudge:        NudgeConfig{HoldTime: 150},
+		SpeedScale:   "none",
+		SOCD:         "neutral",
+		Acceleration: AccelerationConfig{
+			Profile:  "Normal",
+			Profiles: defaultProfiles(),
+		},
+		Scroll: ScrollConfig{
+			Step:         1,
+			InitialSpeed: 4,
+			Speed:        25,
+			RampTime:     1000,
+		},
+		Gamepad: GamepadConfig{
+			Deadzone: 0.15,
+			Curve:    2.0,
+		},
+	}
+}
+
+// defaultConfigPath returns the per-user config file location
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mousekeys", "config.json")
+}
+
+// loadConfig reads the config file at path on top of the defaults.
+// A missing file is not an error.
+func loadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Profiles from the file replace the presets rather than merging into them
+	cfg.Acceleration = AccelerationConfig{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(cfg.Acceleration.Profiles) == 0 {
+		cfg.Acceleration.Profiles = defaultProfiles()
+	}
+	if cfg.Acceleration.Profile == "" {
+		cfg.Acceleration.Profile = DefaultConfig().Acceleration.Profile
+		if _, err := cfg.Acceleration.profile(cfg.Acceleration.Profile); err != nil {
+			cfg.Acceleration.Profile = cfg.Acceleration.Profiles[0].Name
+		}
+	}
+	for _, p := range cfg.Acceleration.Profiles {
+		if _, err := newAccelerationProfile(p); err != nil {
+			return nil, fmt.Errorf("%s: acceleration profile %q: %v", path, p.Name, err)
+		}
+	}
+	if _, err := cfg.Acceleration.profile(cfg.Acceleration.Profile); err != nil {
+		return nil, fmt.Errorf("%s: acceleration: %v", path, err)
+	}
+
+	if cfg.TickInterval < 1 || cfg.TickInterval > 100 {
+		return nil, fmt.Errorf("%s: tickInterval: %v ms is out of range (1-100)", path, cfg.TickInterval)
+	}
+
+	// Every key does one thing: the built-in keys keep their actions and no
+	// key is bound twice, since the hooks could only honor one of them
+	bound := make(map[string]string)
+	bind := func(field, name string) error {
+		if !bindableKey(name) {
+			return fmt.Errorf("%s: %s: %q is not a letter, digit, tab or backspace key", path, field, name)
+		}
+		if slices.Contains(builtinKeys, name) {
+			return fmt.Errorf("%s: %s: %q already has a built-in action", path, field, name)
+		}
+		if other, ok := bound[name]; ok {
+			return fmt.Errorf("%s: %s: %q is already bound by %s", path, field, name, other)
+		}
+		bound[name] = field
+		return nil
+	}
+
+	for _, f := range []struct {
+		field string
+		key   *string
+	}{
+		{"precision", &cfg.Precision.Key},
+		{"turbo", &cfg.Turbo.Key},
+		{"bisect.key", &cfg.Bisect.Key},
+		{"bisect.undoKey", &cfg.Bisect.UndoKey},
+	} {
+		*f.key = strings.ToLower(*f.key)
+		if *f.key == "" {
+			continue
+		}
+		if err := bind(f.field, *f.key); err != nil {
+			return nil, err
+		}
+	}
+	for field, speedKey := range map[string]*SpeedKeyConfig{"precision": &cfg.Precision, "turbo": &cfg.Turbo} {
+		if speedKey.Scale <= 0 {
+			return nil, fmt.Errorf("%s: %s: scale must be positive", path, field)
+		}
+	}
+	if cfg.Inertia.Friction <= 0 {
+		return nil, fmt.Errorf("%s: inertia: friction must be positive", path)
+	}
+	if cfg.Nudge.Distance < 0 || cfg.Nudge.HoldTime <= 0 {
+		return nil, fmt.Errorf("%s: nudge: distance can't be negative and holdTime must be positive", path)
+	}
+	if cfg.Scroll.Step < 0 || cfg.Scroll.InitialSpeed < 0 || cfg.Scroll.Speed <= 0 || cfg.Scroll.RampTime < 0 {
+		return nil, fmt.Errorf("%s: scroll: step, initialSpeed and rampTime can't be negative and speed must be positive", path)
+	}
+	switch cfg.SOCD {
+	case "neutral", "last", "first":
+	default:
+		return nil, fmt.Errorf("%s: socd: %q is not neutral, last or first", path, cfg.SOCD)
+	}
+	switch cfg.SpeedScale {
+	case "none", "resolution", "dpi":
+	default:
+		return nil, fmt.Errorf("%s: speedScale: %q is not none, resolution or dpi", path, cfg.SpeedScale)
+	}
+
+	// Numbered in name order so the keys stay the same between runs
+	cfg.directionKeys = make(map[string]Key)
+	cfg.directions = make(map[Key]direction)
+	for i, name := range slices.Sorted(maps.Keys(cfg.Directions)) {
+		dir := cfg.Directions[name]
+		name = strings.ToLower(name)
+		if err := bind("directions", name); err != nil {
+			return nil, err
+		}
+		d := directionFromAngle(dir.Angle)
+		if dir.X != 0 || dir.Y != 0 {
+			d = directionFromVector(dir.X, dir.Y)
+		}
+		key := keyDirectionBase + Key(i)
+		cfg.directionKeys[name] = key
+		cfg.directions[key] = d
+	}
+
+	buttons := make(map[string]int)
+	for _, name := range slices.Sorted(maps.Keys(cfg.Buttons)) {
+		n := cfg.Buttons[name]
+		name = strings.ToLower(name)
+		if err := bind("buttons", name); err != nil {
+			return nil, err
+		}
+		if !validButton(MouseButton(n)) {
+			return nil, fmt.Errorf("%s: buttons: %d is not a mouse button (1-3 or 8-12)", path, n)
+		}
+		buttons[name] = n
+	}
+	cfg.Buttons = buttons
+	return cfg, nil
+}
+
+// tickInterval returns how often the controller ticks
+func (c *Config) tickInterval() time.Duration {
+	return time.Duration(c.TickInterval * float64(time.Millisecond))
+}
+
+// builtinKeys have fixed actions in every hook, so the config can't bind them
+var builtinKeys = []string{"w", "a", "s", "d", "q", "e", "z", "x", "r", "f", "t", "g", "c", "v"}
+
+// bindableKey reports whether the hooks can name a key for the config bindings
+func bindableKey(name string) bool {
+	return name == "tab" || name == "backspace" || len(name) == 1 && (name[0] >= 'a' && name[0] <= 'z' || name[0] >= '0' && name[0] <= '9')
+}
+
+// boundKey returns the action the config binds to a letter, digit, Tab or
+// Backspace key. loadConfig makes sure each key has at most one.
+func boundKey(name string) Key {
+	if name == "" {
+		return KeyUnknown
+	}
+	if key, ok := config.directionKeys[name]; ok {
+		return key
+	}
+	if n, ok := config.Buttons[name]; ok {
+		return ButtonKey(MouseButton(n))
+	}
+	switch name {
+	case config.Precision.Key:
+		return KeyPrecision
+	case config.Turbo.Key:
+		return KeyTurbo
+	case config.Bisect.Key:
+		return KeyBisect
+	case config.Bisect.UndoKey:
+		return KeyBisectUndo
+	}
+	return KeyUnknown
+}
+
+// stringList is a flag.Value that collects every occurrence of a repeatable flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
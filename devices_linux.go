@@ -0,0 +1,132 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// inputDeviceInfo describes one evdev node as shown by list-devices
+type inputDeviceInfo struct {
+	path       string
+	name       string
+	phys       string
+	id         inputID
+	hasLetters bool
+}
+
+// readInputDeviceInfo queries name, IDs, topology and key capabilities of an open device
+func readInputDeviceInfo(path string, f *os.File) inputDeviceInfo {
+	info := inputDeviceInfo{path: path}
+	info.name, _ = deviceName(f)
+	info.phys, _ = devicePhys(f)
+	info.id, _ = deviceID(f)
+	info.hasLetters = hasLetterKeys(f)
+	return info
+}
+
+// eventDevicePaths returns the /dev/input/eventN nodes in numeric order
+func eventDevicePaths() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(inputDir, "event*"))
+	if err != nil {
+		return nil, err
+	}
+	eventNumber := func(path string) int {
+		n, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(path), "event"))
+		return n
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return eventNumber(paths[i]) < eventNumber(paths[j])
+	})
+	return paths, nil
+}
+
+// matchesSelector reports whether a device matches a user supplied selector.
+// A selector is a device path (symlinks such as /dev/input/by-id/... are
+// resolved), a vendor:product pair in hex, or the device name.
+func matchesSelector(selector string, info inputDeviceInfo) bool {
+	if strings.HasPrefix(selector, "/") {
+		resolved, err := filepath.EvalSymlinks(selector)
+		if err != nil {
+			resolved = selector
+		}
+		return resolved == info.path
+	}
+
+	if vendor, product, ok := parseDeviceID(selector); ok {
+		return vendor == info.id.Vendor && product == info.id.Product
+	}
+
+	return strings.EqualFold(selector, info.name)
+}
+
+// parseDeviceID parses a vendor:product pair of 1 to 4 hex digits each,
+// as lsusb prints them with or without the leading zeros
+func parseDeviceID(selector string) (vendor, product uint16, ok bool) {
+	v, p, found := strings.Cut(selector, ":")
+	if !found || len(v) == 0 || len(v) > 4 || len(p) == 0 || len(p) > 4 {
+		return 0, 0, false
+	}
+	vendorID, verr := strconv.ParseUint(v, 16, 16)
+	productID, perr := strconv.ParseUint(p, 16, 16)
+	if verr != nil || perr != nil {
+		return 0, 0, false
+	}
+	return uint16(vendorID), uint16(productID), true
+}
+
+// isSelectedKeyboard decides whether the hook should use a device.
+// Pinned devices from the config win over the letter-key heuristic.
+func isSelectedKeyboard(info inputDeviceInfo) bool {
+	if strings.HasPrefix(info.name, uinputNamePrefix) {
+		return false
+	}
+	if config == nil || len(config.Devices) == 0 {
+		return info.hasLetters
+	}
+	for _, selector := range config.Devices {
+		if matchesSelector(selector, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// listInputDevices prints every evdev node so users can pick devices to pin
+func listInputDevices(w io.Writer) error {
+	paths, err := eventDevicePaths()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tNAME\tID\tPHYS\tLETTERS\tUSED")
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(tw, "%s\t(%v)\t\t\t\t\n", path, err)
+			continue
+		}
+		info := readInputDeviceInfo(path, f)
+		f.Close()
+
+		fmt.Fprintf(tw, "%s\t%s\t%04x:%04x\t%s\t%s\t%s\n",
+			info.path, info.name, info.id.Vendor, info.id.Product, info.phys,
+			yesNo(info.hasLetters), yesNo(isSelectedKeyboard(info)))
+	}
+	return tw.Flush()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
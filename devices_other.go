@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+// listInputDevices is only meaningful where keyboards are read through evdev
+func listInputDevices(w io.Writer) error {
+	return errors.New("list-devices is only supported on Linux")
+}
@@ -0,0 +1,51 @@
+package main
+
+import "math"
+
+// direction is a unit vector in screen coordinates, y pointing down
+type direction struct {
+	x, y float64
+}
+
+// directionFromAngle returns the direction at an angle in degrees,
+// clockwise from straight up
+func directionFromAngle(degrees float64) direction {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	// Keep exact zeros, so right and left don't lean up or down and
+	// conflict with the vertical keys
+	snap := func(v float64) float64 {
+		if math.Abs(v) < 1e-9 {
+			return 0
+		}
+		return v
+	}
+	return direction{snap(sin), snap(-cos)}
+}
+
+// directionFromVector returns the direction of a vector other than 0, 0
+func directionFromVector(x, y float64) direction {
+	length := math.Hypot(x, y)
+	return direction{x / length, y / length}
+}
+
+// builtinDirections are the WASD and QEZX movement keys
+var builtinDirections = map[Key]direction{
+	KeyMoveUp:        directionFromAngle(0),
+	KeyDiagUpRight:   directionFromAngle(45),
+	KeyMoveRight:     directionFromAngle(90),
+	KeyDiagDownRight: directionFromAngle(135),
+	KeyMoveDown:      directionFromAngle(180),
+	KeyDiagDownLeft:  directionFromAngle(225),
+	KeyMoveLeft:      directionFromAngle(270),
+	KeyDiagUpLeft:    directionFromAngle(315),
+}
+
+// moveKeyDirection returns the direction a movement key moves in, for the
+// built-in keys and those bound in the config
+func moveKeyDirection(key Key) (x, y float64, ok bool) {
+	d, ok := builtinDirections[key]
+	if !ok {
+		d, ok = config.directions[key]
+	}
+	return d.x, d.y, ok
+}
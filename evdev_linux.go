@@ -0,0 +1,231 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// ioctl direction bits from <asm-generic/ioctl.h>
+const (
+	iocNone  = 0
+	iocWrite = 1
+	iocRead  = 2
+)
+
+// ioc builds an ioctl request number the same way the _IOC macro does
+func ioc(dir, typ, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | typ<<8 | nr
+}
+
+// evdev ioctls from <linux/input.h>
+var (
+	eviocgid  = ioc(iocRead, 'E', 0x02, 8)
+	eviocgrab = ioc(iocWrite, 'E', 0x90, 4)
+)
+
+// eviocgname returns the EVIOCGNAME request for a buffer of n bytes
+func eviocgname(n int) uintptr {
+	return ioc(iocRead, 'E', 0x06, uintptr(n))
+}
+
+// eviocgphys returns the EVIOCGPHYS request for a buffer of n bytes
+func eviocgphys(n int) uintptr {
+	return ioc(iocRead, 'E', 0x07, uintptr(n))
+}
+
+// eviocgbit returns the EVIOCGBIT request for event type ev and a buffer of n bytes
+func eviocgbit(ev, n int) uintptr {
+	return ioc(iocRead, 'E', uintptr(0x20+ev), uintptr(n))
+}
+
+// eviocgabs returns the EVIOCGABS request for absolute axis abs
+func eviocgabs(abs uint16) uintptr {
+	return ioc(iocRead, 'E', uintptr(0x40+abs), unsafe.Sizeof(absInfo{}))
+}
+
+// eviocgkey returns the EVIOCGKEY request for a buffer of n bytes
+func eviocgkey(n int) uintptr {
+	return ioc(iocRead, 'E', 0x18, uintptr(n))
+}
+
+// Highest codes the kernel reports (KEY_MAX, ABS_MAX)
+const (
+	linuxKeyMax = 0x2ff
+	linuxAbsMax = 0x3f
+)
+
+// ioctl runs an ioctl on f without switching it to blocking mode,
+// so a pending Read can still be interrupted by Close.
+func ioctl(f *os.File, req, arg uintptr) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg)
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// deviceName returns the human readable name the kernel reports for the device
+func deviceName(f *os.File) (string, error) {
+	var name [256]byte
+	if err := ioctl(f, eviocgname(len(name)), uintptr(unsafe.Pointer(&name[0]))); err != nil {
+		return "", err
+	}
+	return string(bytes.TrimRight(name[:], "\x00")), nil
+}
+
+// devicePhys returns the physical topology path of the device (e.g. usb-0000:00:14.0-1/input0)
+func devicePhys(f *os.File) (string, error) {
+	var phys [256]byte
+	if err := ioctl(f, eviocgphys(len(phys)), uintptr(unsafe.Pointer(&phys[0]))); err != nil {
+		return "", err
+	}
+	return string(bytes.TrimRight(phys[:], "\x00")), nil
+}
+
+// inputID mirrors struct input_id
+type inputID struct {
+	Bustype uint16
+	Vendor  uint16
+	Product uint16
+	Version uint16
+}
+
+// deviceID returns the bus, vendor and product IDs of the device
+func deviceID(f *os.File) (inputID, error) {
+	var id inputID
+	err := ioctl(f, eviocgid, uintptr(unsafe.Pointer(&id)))
+	return id, err
+}
+
+// capabilityBits returns the bitmap of codes the device supports for one event type
+func capabilityBits(f *os.File, evType, maxCode int) ([]byte, error) {
+	bits := make([]byte, maxCode/8+1)
+	if err := ioctl(f, eviocgbit(evType, len(bits)), uintptr(unsafe.Pointer(&bits[0]))); err != nil {
+		return nil, err
+	}
+	return bits, nil
+}
+
+// keyBits returns the EV_KEY capability bitmap of the device
+func keyBits(f *os.File) ([]byte, error) {
+	return capabilityBits(f, EV_KEY, linuxKeyMax)
+}
+
+// absInfo mirrors struct input_absinfo
+type absInfo struct {
+	Value      int32
+	Minimum    int32
+	Maximum    int32
+	Fuzz       int32
+	Flat       int32
+	Resolution int32
+}
+
+// deviceAbsInfo returns the range and current value of an absolute axis
+func deviceAbsInfo(f *os.File, code uint16) (absInfo, error) {
+	var info absInfo
+	err := ioctl(f, eviocgabs(code), uintptr(unsafe.Pointer(&info)))
+	return info, err
+}
+
+// testBit reports whether bit n is set in a kernel capability bitmap
+func testBit(bits []byte, n int) bool {
+	return n/8 < len(bits) && bits[n/8]&(1<<(n%8)) != 0
+}
+
+// Letter rows of a keyboard: KEY_Q..KEY_P, KEY_A..KEY_L, KEY_Z..KEY_M
+var linuxLetterKeyRanges = [][2]int{{16, 25}, {30, 38}, {44, 50}}
+
+// hasLetterKeys reports whether the device can send every letter key.
+// This tells real keyboards apart from power buttons, media remotes and mice.
+func hasLetterKeys(f *os.File) bool {
+	bits, err := keyBits(f)
+	if err != nil {
+		return false
+	}
+	for _, r := range linuxLetterKeyRanges {
+		for code := r[0]; code <= r[1]; code++ {
+			if !testBit(bits, code) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Keyboard LEDs
+const (
+	LED_NUML    = 0x00
+	LED_CAPSL   = 0x01
+	LED_SCROLLL = 0x02
+)
+
+// setLEDs writes LED states to a device opened for writing
+func setLEDs(f *os.File, leds map[uint16]bool) error {
+	buf := make([]byte, (len(leds)+1)*inputEventSize)
+	off := 0
+	for led, on := range leds {
+		var value int32
+		if on {
+			value = 1
+		}
+		encodeInputEvent(buf[off:], inputEventSize, InputEvent{Type: EV_LED, Code: led, Value: value})
+		off += inputEventSize
+	}
+	encodeInputEvent(buf[off:], inputEventSize, InputEvent{Type: EV_SYN, Code: SYN_REPORT})
+	_, err := f.Write(buf)
+	return err
+}
+
+// grabDevice takes (or releases) exclusive access to an evdev device.
+// While grabbed, no other reader - including the display server - sees its events.
+func grabDevice(f *os.File, grab bool) error {
+	var arg uintptr
+	if grab {
+		arg = 1
+	}
+	return ioctl(f, eviocgrab, arg)
+}
+
+// anyKeyDown reports whether the device currently has any key held
+func anyKeyDown(f *os.File) (bool, error) {
+	var state [linuxKeyMax/8 + 1]byte
+	if err := ioctl(f, eviocgkey(len(state)), uintptr(unsafe.Pointer(&state[0]))); err != nil {
+		return false, err
+	}
+	for _, b := range state {
+		if b != 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// waitForKeysReleased blocks until no key is held on the device or the timeout expires.
+// Grabbing while a key is down (e.g. Enter used to launch us from a terminal)
+// leaves the display server with a key that is never released.
+func waitForKeysReleased(f *os.File, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		down, err := anyKeyDown(f)
+		if err != nil || !down {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,237 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDecodeInputEventsBothLayouts(t *testing.T) {
+	want := []InputEvent{
+		{Time: time.Unix(1700000000, 123456000), Type: EV_KEY, Code: linuxKeyW, Value: KEY_PRESSED},
+		{Time: time.Unix(1700000000, 123456000), Type: EV_SYN, Code: SYN_REPORT, Value: 0},
+		{Time: time.Unix(1700000000, 250000000), Type: EV_KEY, Code: linuxKeyW, Value: KEY_RELEASED},
+	}
+
+	for _, size := range []int{inputEventSize32, inputEventSize64} {
+		buf := make([]byte, len(want)*size)
+		for i, ev := range want {
+			encodeInputEvent(buf[i*size:], size, ev)
+		}
+
+		got := decodeInputEvents(buf, size, nil)
+		if len(got) != len(want) {
+			t.Fatalf("size %d: decoded %d events, want %d", size, len(got), len(want))
+		}
+		for i := range want {
+			if !got[i].Time.Equal(want[i].Time) || got[i].Type != want[i].Type ||
+				got[i].Code != want[i].Code || got[i].Value != want[i].Value {
+				t.Errorf("size %d: event %d = %+v, want %+v", size, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestDecodeInputEventsIgnoresPartialEvent(t *testing.T) {
+	buf := make([]byte, inputEventSize+inputEventSize/2)
+	encodeInputEvent(buf, inputEventSize, InputEvent{Type: EV_KEY, Code: linuxKeyA, Value: KEY_REPEAT})
+
+	got := decodeInputEvents(buf, inputEventSize, nil)
+	if len(got) != 1 || got[0].Code != linuxKeyA || got[0].Value != KEY_REPEAT {
+		t.Errorf("Expected one decoded A repeat, got %+v", got)
+	}
+}
+
+func TestTranslateInputEvent(t *testing.T) {
+	keyboard1, keyboard2 := map[uint16]Key{}, map[uint16]Key{}
+	steps := []struct {
+		name        string
+		consumed    map[uint16]Key
+		code        uint16
+		value       int32
+		active      bool
+		wantDeliver bool
+		wantSwallow bool
+		wantType    KeyEventType
+	}{
+		{"press while active", keyboard1, linuxKeyW, KEY_PRESSED, true, true, true, KeyDown},
+		{"repeat of a swallowed press", keyboard1, linuxKeyW, KEY_REPEAT, true, false, true, 0},
+		{"release after toggling off", keyboard1, linuxKeyW, KEY_RELEASED, false, true, true, KeyUp},
+		{"press while inactive", keyboard1, linuxKeyW, KEY_PRESSED, false, false, false, 0},
+		{"repeat of a passed press", keyboard1, linuxKeyW, KEY_REPEAT, true, false, false, 0},
+		{"release of a passed press", keyboard1, linuxKeyW, KEY_RELEASED, true, false, false, 0},
+		{"press on the first keyboard", keyboard1, linuxKeyD, KEY_PRESSED, true, true, true, KeyDown},
+		{"release on the second keyboard", keyboard2, linuxKeyD, KEY_RELEASED, true, false, false, 0},
+		{"release on the first keyboard", keyboard1, linuxKeyD, KEY_RELEASED, true, true, true, KeyUp},
+		{"Caps Lock press while inactive", keyboard1, linuxKeyCapsLock, KEY_PRESSED, false, true, true, FlagsChanged},
+		{"Caps Lock repeat", keyboard1, linuxKeyCapsLock, KEY_REPEAT, true, false, true, 0},
+		{"Caps Lock release while active", keyboard1, linuxKeyCapsLock, KEY_RELEASED, true, false, true, 0},
+	}
+
+	for _, step := range steps {
+		event := InputEvent{Type: EV_KEY, Code: step.code, Value: step.value}
+		evt, deliver, swallow := translateInputEvent(step.consumed, event, step.active)
+		if deliver != step.wantDeliver || swallow != step.wantSwallow {
+			t.Errorf("%s: deliver=%v swallow=%v, want deliver=%v swallow=%v",
+				step.name, deliver, swallow, step.wantDeliver, step.wantSwallow)
+		}
+		if deliver && evt.EventType != step.wantType {
+			t.Errorf("%s: event type %v, want %v", step.name, evt.EventType, step.wantType)
+		}
+	}
+	if len(keyboard1) != 0 || len(keyboard2) != 0 {
+		t.Errorf("Expected every swallowed press to be released, still holding %v and %v", keyboard1, keyboard2)
+	}
+}
+
+func TestMatchesSelector(t *testing.T) {
+	dir := t.TempDir()
+	node := filepath.Join(dir, "event3")
+	if err := os.WriteFile(node, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	byID := filepath.Join(dir, "usb-Logitech_USB_Receiver-if02-event-kbd")
+	if err := os.Symlink(node, byID); err != nil {
+		t.Fatal(err)
+	}
+	node, _ = filepath.EvalSymlinks(node)
+	info := inputDeviceInfo{path: node, name: "Logitech USB Receiver", id: inputID{Vendor: 0x046d, Product: 0xc52b}}
+
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{node, true},
+		{byID, true},
+		{filepath.Join(dir, "event4"), false},
+		{"046d:c52b", true},
+		{"46d:C52B", true},
+		{"046d:c52c", false},
+		{"0046d:c52b", false},
+		{"logitech usb receiver", true},
+		{"Logitech", false},
+	}
+	for _, tt := range tests {
+		if got := matchesSelector(tt.selector, info); got != tt.want {
+			t.Errorf("matchesSelector(%q) = %v, want %v", tt.selector, got, tt.want)
+		}
+	}
+}
+
+func TestIsSelectedKeyboard(t *testing.T) {
+	defer func(saved []string) { config.Devices = saved }(config.Devices)
+
+	keyboard := inputDeviceInfo{name: "Keychron K2", hasLetters: true}
+	virtual := inputDeviceInfo{name: uinputNamePrefix + " virtual keyboard", hasLetters: true}
+	remote := inputDeviceInfo{name: "Media Remote"}
+
+	config.Devices = nil
+	if !isSelectedKeyboard(keyboard) || isSelectedKeyboard(virtual) || isSelectedKeyboard(remote) {
+		t.Error("Without pinned devices only real keyboards with letter keys should be used")
+	}
+
+	config.Devices = []string{"media remote", uinputNamePrefix + " virtual keyboard"}
+	if isSelectedKeyboard(keyboard) || isSelectedKeyboard(virtual) || !isSelectedKeyboard(remote) {
+		t.Error("Pinned devices should be used instead, never our own virtual keyboard")
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestReplayInput(t *testing.T) {
+	var file bytes.Buffer
+	rec, err := newInputRecorder(nopWriteCloser{&file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := rec.device("Test Keyboard")
+
+	start := time.Unix(1700000000, 0)
+	for _, ev := range []InputEvent{
+		{Time: start, Type: EV_KEY, Code: linuxKeyCapsLock, Value: KEY_PRESSED},
+		{Time: start.Add(50 * time.Millisecond), Type: EV_KEY, Code: linuxKeyCapsLock, Value: KEY_RELEASED},
+		{Time: start.Add(100 * time.Millisecond), Type: EV_KEY, Code: linuxKeyD, Value: KEY_PRESSED},
+		{Time: start.Add(600 * time.Millisecond), Type: EV_KEY, Code: linuxKeyD, Value: KEY_RELEASED},
+		{Time: start.Add(900 * time.Millisecond), Type: EV_KEY, Code: linuxKeyS, Value: KEY_PRESSED},
+	} {
+		buf := make([]byte, inputEventSize)
+		encodeInputEvent(buf, inputEventSize, ev)
+		rec.events(id, buf)
+	}
+	// Unplugging the keyboard releases the S still held
+	rec.removed(id)
+	rec.Close()
+
+	pointer := newRecordingPointer(1920, 1080)
+	pointer.Move(100, 100)
+	mc := NewMouseController(pointer)
+	if err := replayInput(&file, mc); err != nil {
+		t.Fatal(err)
+	}
+
+	if !mc.IsActive() {
+		t.Error("Caps Lock in the recording should have turned mouse mode on")
+	}
+	// Half a second of D: a precision phase, then normal speed
+	x, y := pointer.Location()
+	if moved := x - 100; moved < 250 || moved > 450 {
+		t.Errorf("pointer moved %d px right, want about 350", moved)
+	}
+	if y != 100 {
+		t.Errorf("pointer Y = %d, want 100", y)
+	}
+	if slices.Contains(mc.moveOrder, KeyMoveDown) {
+		t.Error("S should be released when its device is removed")
+	}
+}
+
+func TestReplayInputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.bin")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := newInputRecorder(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := rec.device("Test Keyboard")
+	start := time.Unix(1700000000, 0)
+	for _, ev := range []InputEvent{
+		{Time: start, Type: EV_KEY, Code: linuxKeyCapsLock, Value: KEY_PRESSED},
+		{Time: start.Add(50 * time.Millisecond), Type: EV_KEY, Code: linuxKeySpace, Value: KEY_PRESSED},
+		{Time: start.Add(100 * time.Millisecond), Type: EV_KEY, Code: linuxKeySpace, Value: KEY_RELEASED},
+	} {
+		buf := make([]byte, inputEventSize)
+		encodeInputEvent(buf, inputEventSize, ev)
+		rec.events(id, buf)
+	}
+	rec.Close()
+
+	var out bytes.Buffer
+	if err := replayInputFile(path, &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "press left\nrelease left\n"; out.String() != want {
+		t.Errorf("replay printed %q, want %q", out.String(), want)
+	}
+}
+
+func TestHiResWheelSplitsNotches(t *testing.T) {
+	var w hiResWheel
+	want := []struct{ hiRes, notches int32 }{{60, 0}, {60, 1}, {60, 0}, {-180, -1}}
+	for i, amount := range []float64{0.5, 0.5, 0.5, -1.5} {
+		hiRes, notches := w.add(amount)
+		if hiRes != want[i].hiRes || notches != want[i].notches {
+			t.Errorf("add %d: got (%d, %d), want (%d, %d)", i, hiRes, notches, want[i].hiRes, want[i].notches)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import "math"
+
+// stickResponse applies a radial deadzone and a response curve to a stick
+// position with both axes in -1..1. The result keeps the stick's direction;
+// its length grows from 0 at the edge of the deadzone to 1 at full deflection.
+func stickResponse(x, y, deadzone, curve float64) (float64, float64) {
+	magnitude := math.Hypot(x, y)
+	if magnitude <= deadzone || magnitude == 0 {
+		return 0, 0
+	}
+
+	scaled := math.Min((magnitude-deadzone)/(1-deadzone), 1)
+	if curve > 0 {
+		scaled = math.Pow(scaled, curve)
+	}
+	return x / magnitude * scaled, y / magnitude * scaled
+}
@@ -0,0 +1,235 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+// evdev absolute axes and gamepad / joystick buttons
+const (
+	EV_ABS = 3
+
+	ABS_X  = 0x00
+	ABS_Y  = 0x01
+	ABS_RX = 0x03
+	ABS_RY = 0x04
+
+	BTN_TRIGGER = 0x120
+	BTN_THUMB   = 0x121
+	BTN_SOUTH   = 0x130
+	BTN_EAST    = 0x131
+	BTN_NORTH   = 0x133
+	BTN_WEST    = 0x134
+	BTN_TL      = 0x136
+	BTN_TR      = 0x137
+	BTN_START   = 0x13b
+	BTN_MODE    = 0x13c
+)
+
+// gamepadAxis tracks one absolute axis normalized to -1..1
+type gamepadAxis struct {
+	info  absInfo
+	value float64
+}
+
+func (a *gamepadAxis) set(raw int32) {
+	center := (float64(a.info.Minimum) + float64(a.info.Maximum)) / 2
+	half := (float64(a.info.Maximum) - float64(a.info.Minimum)) / 2
+	if half <= 0 {
+		a.value = 0
+		return
+	}
+	a.value = math.Max(-1, math.Min(1, (float64(raw)-center)/half))
+}
+
+// gamepadSource feeds a MouseController from an evdev gamepad: the left
+// stick moves the pointer, the right stick scrolls and face buttons click
+type gamepadSource struct {
+	cfg    GamepadConfig
+	mc     *MouseController
+	handle func(KeyEvent)
+	axes   map[uint16]*gamepadAxis
+	held   map[uint16]Key
+}
+
+// startGamepad opens the configured gamepad and starts feeding mc.
+// Button presses go through handle like keyboard events do.
+func startGamepad(cfg GamepadConfig, mc *MouseController, handle func(KeyEvent)) error {
+	f, name, err := openGamepad(cfg.Device)
+	if err != nil {
+		return err
+	}
+
+	g := &gamepadSource{
+		cfg:    cfg,
+		mc:     mc,
+		handle: handle,
+		held:   make(map[uint16]Key),
+	}
+	go g.run(f, name)
+	return nil
+}
+
+// run reads the gamepad, and keeps looking for it again after it goes away
+func (g *gamepadSource) run(f *os.File, name string) {
+	for {
+		fmt.Printf("Using gamepad %s\n", name)
+		err := g.read(f)
+		f.Close()
+		g.reset()
+		fmt.Printf("Lost gamepad %s: %v\n", name, err)
+
+		for {
+			time.Sleep(2 * time.Second)
+			if f, name, err = openGamepad(g.cfg.Device); err == nil {
+				break
+			}
+		}
+	}
+}
+
+// read pumps events from an open gamepad until it fails
+func (g *gamepadSource) read(f *os.File) error {
+	g.axes = make(map[uint16]*gamepadAxis)
+	for _, code := range []uint16{ABS_X, ABS_Y, ABS_RX, ABS_RY} {
+		if info, err := deviceAbsInfo(f, code); err == nil {
+			axis := &gamepadAxis{info: info}
+			axis.set(info.Value)
+			g.axes[code] = axis
+		}
+	}
+
+	buf := make([]byte, 64*inputEventSize)
+	var events []InputEvent
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			return err
+		}
+
+		events = decodeInputEvents(buf[:n], inputEventSize, events[:0])
+		for _, event := range events {
+			switch event.Type {
+			case EV_ABS:
+				if axis := g.axes[event.Code]; axis != nil {
+					axis.set(event.Value)
+				}
+			case EV_KEY:
+				g.button(event)
+			case EV_SYN:
+				if event.Code == SYN_REPORT {
+					g.applySticks()
+				}
+			}
+		}
+	}
+}
+
+// applySticks hands the current stick positions to the controller
+func (g *gamepadSource) applySticks() {
+	mx, my := stickResponse(g.axis(ABS_X), g.axis(ABS_Y), g.cfg.Deadzone, g.cfg.Curve)
+	g.mc.SetAnalogMove(mx, my)
+
+	// Pushing the stick up (negative Y) scrolls up
+	sx, sy := stickResponse(g.axis(ABS_RX), g.axis(ABS_RY), g.cfg.Deadzone, g.cfg.Curve)
+	g.mc.SetAnalogScroll(sx, -sy)
+}
+
+func (g *gamepadSource) axis(code uint16) float64 {
+	if axis := g.axes[code]; axis != nil {
+		return axis.value
+	}
+	return 0
+}
+
+// button turns a button press or release into a KeyEvent
+func (g *gamepadSource) button(event InputEvent) {
+	switch event.Value {
+	case KEY_PRESSED:
+		key := translateGamepadButton(event.Code)
+		if key == KeyUnknown {
+			return
+		}
+		evt := KeyEvent{Keycode: key, RawCode: int64(event.Code), Time: event.Time}
+		if key == KeyToggle {
+			evt.EventType = FlagsChanged
+		} else {
+			g.held[event.Code] = key
+			evt.EventType = KeyDown
+		}
+		g.handle(evt)
+	case KEY_RELEASED:
+		if key, ok := g.held[event.Code]; ok {
+			delete(g.held, event.Code)
+			g.handle(KeyEvent{Keycode: key, EventType: KeyUp, RawCode: int64(event.Code), Time: event.Time})
+		}
+	}
+}
+
+// reset stops all motion and releases held buttons after the gamepad is lost
+func (g *gamepadSource) reset() {
+	g.mc.SetAnalogMove(0, 0)
+	g.mc.SetAnalogScroll(0, 0)
+	for code, key := range g.held {
+		delete(g.held, code)
+		g.handle(KeyEvent{Keycode: key, EventType: KeyUp, RawCode: int64(code), Time: time.Now()})
+	}
+}
+
+// translateGamepadButton converts a gamepad or joystick button to unified Key
+func translateGamepadButton(code uint16) Key {
+	switch code {
+	case BTN_SOUTH, BTN_TRIGGER:
+		return KeyLeftClick
+	case BTN_EAST, BTN_THUMB:
+		return KeyRightClick
+	case BTN_NORTH, BTN_WEST:
+		return KeyMiddleClick
+	case BTN_TL:
+		return KeyBack
+	case BTN_TR:
+		return KeyForward
+	case BTN_START, BTN_MODE:
+		return KeyToggle
+	default:
+		return KeyUnknown
+	}
+}
+
+// openGamepad opens the first evdev node that has a stick and gamepad or
+// joystick buttons, or the one matching selector when it is set
+func openGamepad(selector string) (*os.File, string, error) {
+	paths, err := eventDevicePaths()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+
+		info := readInputDeviceInfo(path, f)
+		if selector != "" && matchesSelector(selector, info) || selector == "" && isGamepad(f) {
+			return f, info.name, nil
+		}
+		f.Close()
+	}
+	return nil, "", errors.New("no gamepad found in /dev/input")
+}
+
+// isGamepad reports whether the device has a stick and gamepad or joystick buttons
+func isGamepad(f *os.File) bool {
+	abs, err := capabilityBits(f, EV_ABS, linuxAbsMax)
+	if err != nil || !testBit(abs, ABS_X) || !testBit(abs, ABS_Y) {
+		return false
+	}
+	keys, err := keyBits(f)
+	return err == nil && (testBit(keys, BTN_SOUTH) || testBit(keys, BTN_TRIGGER))
+}
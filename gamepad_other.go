@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// startGamepad is only implemented on top of evdev
+func startGamepad(cfg GamepadConfig, mc *MouseController, handle func(KeyEvent)) error {
+	return errors.New("gamepad input is only supported on Linux")
+}
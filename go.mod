@@ -5,6 +5,7 @@ go 1.25.5
 require (
 	github.com/getlantern/systray v1.2.2
 	github.com/go-vgo/robotgo v1.0.0
+	github.com/jezek/xgb v1.2.0
 )
 
 require (
@@ -20,7 +21,6 @@ require (
 	github.com/go-ole/go-ole v1.3.0 // indirect
 	github.com/go-stack/stack v1.8.0 // indirect
 	github.com/godbus/dbus/v5 v5.2.0 // indirect
-	github.com/jezek/xgb v1.2.0 // indirect
 	github.com/lufia/plan9stats v0.0.0-20251013123823-9fd1530e3ec3 // indirect
 	github.com/otiai10/gosseract/v2 v2.4.1 // indirect
 	github.com/oxtoacart/bpool v0.0.0-20190530202638-03653db5a59c // indirect
@@ -0,0 +1,74 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const inputDir = "/dev/input"
+
+// inputWatcher reports evdev nodes appearing in and disappearing from /dev/input
+type inputWatcher struct {
+	file *os.File
+}
+
+// newInputWatcher starts watching /dev/input with inotify
+func newInputWatcher() (*inputWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	// IN_ATTRIB matters: udev creates the node first and fixes its
+	// permissions afterwards, so the first open attempt may be refused.
+	mask := uint32(syscall.IN_CREATE | syscall.IN_ATTRIB | syscall.IN_DELETE)
+	if _, err := syscall.InotifyAddWatch(fd, inputDir, mask); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	// A non-blocking fd gives a pollable *os.File, so Close unblocks run
+	return &inputWatcher{file: os.NewFile(uintptr(fd), "inotify")}, nil
+}
+
+// run calls added or removed for every eventN node change until the watcher is closed
+func (w *inputWatcher) run(added, removed func(path string)) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			start := off + syscall.SizeofInotifyEvent
+			off = start + nameLen
+			if off > n {
+				break
+			}
+
+			name := string(bytes.TrimRight(buf[start:off], "\x00"))
+			if !strings.HasPrefix(name, "event") {
+				continue
+			}
+			path := filepath.Join(inputDir, name)
+
+			if mask&syscall.IN_DELETE != 0 {
+				removed(path)
+			} else {
+				added(path)
+			}
+		}
+	}
+}
+
+// Close stops the watcher
+func (w *inputWatcher) Close() error {
+	return w.file.Close()
+}
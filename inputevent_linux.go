@@ -0,0 +1,74 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"strconv"
+	"time"
+)
+
+// InputEvent represents a Linux input event
+type InputEvent struct {
+	Time  time.Time // Kernel timestamp (CLOCK_REALTIME unless changed with EVIOCSCLOCKID)
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// struct input_event starts with two kernel longs (seconds and microseconds),
+// followed by type, code and value. That makes it 24 bytes on 64-bit and
+// 16 bytes on 32-bit, including time64 userspace, where the kernel still
+// uses __kernel_ulong_t for the timestamp.
+const (
+	inputEventSize32 = 16
+	inputEventSize64 = 24
+	inputEventSize   = 2*strconv.IntSize/8 + 8
+)
+
+// decodeInputEvents appends every whole event in buf to events.
+// size selects the layout (inputEventSize32 or inputEventSize64) and any
+// trailing partial event is ignored. Events are in native byte order.
+func decodeInputEvents(buf []byte, size int, events []InputEvent) []InputEvent {
+	word := (size - 8) / 2
+	for ; len(buf) >= size; buf = buf[size:] {
+		var sec, usec int64
+		if word == 8 {
+			sec = int64(binary.NativeEndian.Uint64(buf[0:]))
+			usec = int64(binary.NativeEndian.Uint64(buf[8:]))
+		} else {
+			sec = int64(binary.NativeEndian.Uint32(buf[0:]))
+			usec = int64(binary.NativeEndian.Uint32(buf[4:]))
+		}
+
+		events = append(events, InputEvent{
+			Time:  time.Unix(sec, usec*int64(time.Microsecond)),
+			Type:  binary.NativeEndian.Uint16(buf[2*word:]),
+			Code:  binary.NativeEndian.Uint16(buf[2*word+2:]),
+			Value: int32(binary.NativeEndian.Uint32(buf[2*word+4:])),
+		})
+	}
+	return events
+}
+
+// encodeInputEvent writes ev into buf using the given layout.
+// A zero Time is written as a zero timestamp.
+func encodeInputEvent(buf []byte, size int, ev InputEvent) {
+	word := (size - 8) / 2
+	var sec, usec int64
+	if !ev.Time.IsZero() {
+		sec = ev.Time.Unix()
+		usec = int64(ev.Time.Nanosecond()) / int64(time.Microsecond)
+	}
+
+	if word == 8 {
+		binary.NativeEndian.PutUint64(buf[0:], uint64(sec))
+		binary.NativeEndian.PutUint64(buf[8:], uint64(usec))
+	} else {
+		binary.NativeEndian.PutUint32(buf[0:], uint32(sec))
+		binary.NativeEndian.PutUint32(buf[4:], uint32(usec))
+	}
+	binary.NativeEndian.PutUint16(buf[2*word:], ev.Type)
+	binary.NativeEndian.PutUint16(buf[2*word+2:], ev.Code)
+	binary.NativeEndian.PutUint32(buf[2*word+4:], uint32(ev.Value))
+}
@@ -0,0 +1,216 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// A recording starts with a header: the magic string, a byte order mark
+// (0x0102 as a uint16) and the input_event size. It is followed by records
+// that each start with a kind byte and a uint16 device number:
+//
+//	'D' a device was attached: uint16 name length, then the name
+//	'E' raw input_event bytes as read from that device
+//	'R' the device was detached
+//
+// Everything is in native byte order, like the events themselves.
+const inputRecordMagic = "MKINPUT1"
+
+const (
+	recordDevice  = 'D'
+	recordEvent   = 'E'
+	recordRemoved = 'R'
+)
+
+// inputRecorder writes the raw events read by LinuxKeyboardHook to a file
+type inputRecorder struct {
+	mu     sync.Mutex
+	file   io.WriteCloser
+	w      *bufio.Writer
+	next   uint16
+	failed bool
+}
+
+func newInputRecorder(file io.WriteCloser) (*inputRecorder, error) {
+	r := &inputRecorder{file: file, w: bufio.NewWriter(file)}
+	r.w.WriteString(inputRecordMagic)
+	binary.Write(r.w, binary.NativeEndian, uint16(0x0102))
+	r.w.WriteByte(inputEventSize)
+	if err := r.w.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write recording: %v", err)
+	}
+	return r, nil
+}
+
+// device records a newly attached device and returns its number
+func (r *inputRecorder) device(name string) uint16 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := r.next
+	r.next++
+	r.header(recordDevice, id)
+	binary.Write(r.w, binary.NativeEndian, uint16(len(name)))
+	r.w.WriteString(name)
+	r.flush()
+	return id
+}
+
+// events records a buffer of whole events read from a device
+func (r *inputRecorder) events(id uint16, buf []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for ; len(buf) >= inputEventSize; buf = buf[inputEventSize:] {
+		r.header(recordEvent, id)
+		r.w.Write(buf[:inputEventSize])
+	}
+	// Flushed per read so a session killed with Ctrl-C is still complete
+	r.flush()
+}
+
+// removed records that a device was detached
+func (r *inputRecorder) removed(id uint16) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.header(recordRemoved, id)
+	r.flush()
+}
+
+func (r *inputRecorder) header(kind byte, id uint16) {
+	r.w.WriteByte(kind)
+	binary.Write(r.w, binary.NativeEndian, id)
+}
+
+// flush writes out buffered records; the caller holds r.mu
+func (r *inputRecorder) flush() {
+	if err := r.w.Flush(); err != nil && !r.failed {
+		r.failed = true
+		fmt.Printf("Failed to write input recording: %v\n", err)
+	}
+}
+
+func (r *inputRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flush()
+	return r.file.Close()
+}
+
+// replayInputFile replays the recording at path with the current config and
+// writes the pointer calls it makes to w, one per line. The pointer starts in
+// the middle of a 1920x1080 screen.
+func replayInputFile(path string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	pointer := newRecordingPointer(1920, 1080)
+	pointer.x, pointer.y = 960, 540
+	if err := replayInput(f, NewMouseController(pointer)); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for _, op := range pointer.Ops() {
+		fmt.Fprintln(w, op)
+	}
+	return nil
+}
+
+// replayInput feeds a recording into mc through the same translation
+// LinuxKeyboardHook uses. Time is simulated from the recorded timestamps,
+// with mc ticking every configured tick interval like RunLoop does. mc should drive a
+// recordingPointer rather than the real one.
+func replayInput(r io.Reader, mc *MouseController) error {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(inputRecordMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != inputRecordMagic {
+		return errors.New("not an input recording")
+	}
+	var bom uint16
+	if err := binary.Read(br, binary.NativeEndian, &bom); err != nil || bom != 0x0102 {
+		return errors.New("input recording has a different byte order")
+	}
+	size, err := br.ReadByte()
+	if err != nil {
+		return fmt.Errorf("truncated input recording: %v", err)
+	}
+	if size != inputEventSize32 && size != inputEventSize64 {
+		return fmt.Errorf("unsupported input_event size %d", size)
+	}
+
+	var clock, nextTick time.Time
+	mc.now = func() time.Time { return clock }
+
+	devices := make(map[uint16]map[uint16]Key)
+	buf := make([]byte, size)
+	var events []InputEvent
+	for {
+		kind, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		var id uint16
+		if err == nil {
+			err = binary.Read(br, binary.NativeEndian, &id)
+		}
+		if err != nil {
+			return fmt.Errorf("truncated input recording: %v", err)
+		}
+
+		switch kind {
+		case recordDevice:
+			var n uint16
+			if err := binary.Read(br, binary.NativeEndian, &n); err != nil {
+				return fmt.Errorf("truncated input recording: %v", err)
+			}
+			if _, err := br.Discard(int(n)); err != nil {
+				return fmt.Errorf("truncated input recording: %v", err)
+			}
+			devices[id] = make(map[uint16]Key)
+		case recordRemoved:
+			for code, key := range devices[id] {
+				mc.HandleKeyEvent(KeyEvent{Keycode: key, EventType: KeyUp, RawCode: int64(code), Time: clock})
+			}
+			delete(devices, id)
+		case recordEvent:
+			if _, err := io.ReadFull(br, buf); err != nil {
+				return fmt.Errorf("truncated input recording: %v", err)
+			}
+			events = decodeInputEvents(buf, int(size), events[:0])
+			event := events[0]
+
+			// Run the ticks that happened before this event
+			if nextTick.IsZero() {
+				nextTick = event.Time
+			}
+			for !nextTick.After(event.Time) {
+				clock = nextTick
+				mc.tick()
+				nextTick = nextTick.Add(config.tickInterval())
+			}
+			clock = event.Time
+
+			consumed := devices[id]
+			if consumed == nil {
+				return fmt.Errorf("input recording has events for unknown device %d", id)
+			}
+			if evt, deliver, _ := translateInputEvent(consumed, event, mc.IsActive()); deliver {
+				mc.HandleKeyEvent(evt)
+			}
+		default:
+			return fmt.Errorf("corrupt input recording: record kind %q", kind)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+// replayInputFile needs the evdev recordings only the Linux hook makes
+func replayInputFile(path string, w io.Writer) error {
+	return errors.New("replay-input is only supported on Linux")
+}
@@ -1,5 +1,7 @@
 package main
 
+import "io"
+
 // KeyboardHook is the interface for platform-specific keyboard hooks
 type KeyboardHook interface {
 	// Start begins capturing keyboard events
@@ -10,6 +12,20 @@ type KeyboardHook interface {
 	Stop() error
 }
 
+// ModeIndicator is implemented by hooks that follow the mouse mode, such as
+// with a keyboard LED or the X11 keyboard grab
+type ModeIndicator interface {
+	// SetModeIndicator is called with the new mode after every toggle
+	SetModeIndicator(active bool)
+}
+
+// InputRecorder is implemented by hooks that can save their raw input,
+// so a session can be replayed when reporting a bug
+type InputRecorder interface {
+	// RecordInput starts writing raw input to file, which the hook closes on Stop
+	RecordInput(file io.WriteCloser) error
+}
+
 // Autostart is the interface for platform-specific autostart functionality
 type Autostart interface {
 	// IsEnabled returns whether autostart is currently enabled
@@ -53,6 +53,10 @@ const (
 	darwinKeyX        = 7
 	darwinKeyR        = 15
 	darwinKeyF        = 3
+	darwinKeyT        = 17
+	darwinKeyG        = 5
+	darwinKeyC        = 8
+	darwinKeyV        = 9
 	darwinKeySpace    = 49
 	darwinKeyLCtrl    = 59
 	darwinKeyLShift   = 56
@@ -145,11 +149,28 @@ func translateKeycode(keycode int64) Key {
 		return KeyScrollUp
 	case darwinKeyF:
 		return KeyScrollDown
+	case darwinKeyT:
+		return KeyScrollLeft
+	case darwinKeyG:
+		return KeyScrollRight
+	case darwinKeyC:
+		return KeyBack
+	case darwinKeyV:
+		return KeyForward
 	default:
-		return KeyUnknown
+		return boundKey(darwinKeyNames[keycode])
 	}
 }
 
+// darwinKeyNames names the letter, digit, Tab and Backspace keys, for the key bindings in the config
+var darwinKeyNames = map[int64]string{
+	0: "a", 1: "s", 2: "d", 3: "f", 4: "h", 5: "g", 6: "z", 7: "x", 8: "c", 9: "v",
+	11: "b", 12: "q", 13: "w", 14: "e", 15: "r", 16: "y", 17: "t",
+	18: "1", 19: "2", 20: "3", 21: "4", 22: "6", 23: "5", 25: "9", 26: "7", 28: "8", 29: "0",
+	31: "o", 32: "u", 34: "i", 35: "p", 37: "l", 38: "j", 40: "k", 45: "n", 46: "m",
+	48: "tab", 51: "backspace",
+}
+
 //export eventCallback
 func eventCallback(proxy C.CGEventTapProxy, eventType C.CGEventType, event C.CGEventRef, refcon unsafe.Pointer) C.CGEventRef {
 	keycode := int64(C.CGEventGetIntegerValueField(event, C.kCGKeyboardEventKeycode))
@@ -159,6 +180,7 @@ func eventCallback(proxy C.CGEventTapProxy, eventType C.CGEventType, event C.CGE
 	evt.RawCode = keycode
 	evt.Flags = flags
 	evt.Keycode = translateKeycode(keycode)
+	evt.Time = time.Now()
 
 	// Handle modifier keys via flags changed event
 	if eventType == C.kCGEventFlagsChanged {
@@ -3,12 +3,12 @@
 package main
 
 import (
-	"bufio"
-	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
-	"strings"
+	"sync"
+	"time"
 )
 
 // Linux evdev key codes
@@ -24,6 +24,10 @@ const (
 	linuxKeyX         = 45
 	linuxKeyR         = 19
 	linuxKeyF         = 33
+	linuxKeyT         = 20
+	linuxKeyG         = 34
+	linuxKeyC         = 46
+	linuxKeyV         = 47
 	linuxKeySpace     = 57
 	linuxKeyLeftCtrl  = 29
 	linuxKeyLeftShift = 42
@@ -41,98 +45,425 @@ const (
 	KEY_REPEAT   = 2
 )
 
-// InputEvent represents a Linux input event
-type InputEvent struct {
-	Time  [16]byte // struct timeval
-	Type  uint16
-	Code  uint16
-	Value int32
+// evdevDevice is one opened keyboard together with its per-device key state
+type evdevDevice struct {
+	path     string
+	name     string
+	file     *os.File
+	grabbed  bool
+	recordID uint16
+
+	// consumed holds the codes whose press was swallowed, so the matching
+	// repeats and release are swallowed as well even if the mode changed since
+	consumed map[uint16]Key
 }
 
 // LinuxKeyboardHook implements KeyboardHook for Linux
 type LinuxKeyboardHook struct {
 	eventChan chan KeyEvent
 	running   bool
-	device    *os.File
+	mu        sync.Mutex
+	devices   map[string]*evdevDevice
+	virtual   *uinputDevice
+	watcher   *inputWatcher
+	readers   sync.WaitGroup
 	stopChan  chan struct{}
+	recorder  *inputRecorder
+
+	// LED state requested by the system through the virtual keyboard, and
+	// whether the mode indicator LED should be lit on top of it
+	systemLEDs map[uint16]bool
+	indicator  bool
 }
 
-// NewKeyboardHook creates a new keyboard hook for Linux
-func NewKeyboardHook() KeyboardHook {
+// NewLinuxKeyboardHook creates a keyboard hook that reads evdev devices directly
+func NewLinuxKeyboardHook() *LinuxKeyboardHook {
 	return &LinuxKeyboardHook{
 		eventChan: make(chan KeyEvent, 100),
+		devices:   make(map[string]*evdevDevice),
 		stopChan:  make(chan struct{}),
+
+		systemLEDs: make(map[uint16]bool),
 	}
 }
 
 func (h *LinuxKeyboardHook) Start() (<-chan KeyEvent, error) {
-	// Find keyboard device
-	devicePath, err := findKeyboardDevice()
-	if err != nil {
+	// Open every keyboard before the virtual keyboard exists,
+	// so we never end up reading our own output back.
+	devices, err := openKeyboardDevices()
+	if err != nil && !errors.Is(err, errNoKeyboard) {
 		return nil, fmt.Errorf("failed to find keyboard device: %v", err)
 	}
 
-	h.device, err = os.Open(devicePath)
+	// Take the devices exclusively and re-emit everything we don't consume
+	// through a virtual keyboard, so mapped keys never reach the focused app.
+	h.virtual, err = createUinputDevice(uinputNamePrefix+" virtual keyboard", uinputProductKbd, uinputCapabilities{
+		keys: keyboardKeyCodes(),
+		msc:  []uint16{MSC_SCAN},
+		leds: []uint16{LED_NUML, LED_CAPSL, LED_SCROLLL},
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to open keyboard device %s: %v (try running as root or add user to 'input' group)", devicePath, err)
+		fmt.Printf("Keyboard grab unavailable, mapped keys will also reach the focused app: %v\n", err)
+	} else {
+		go h.readLEDs()
 	}
 
 	h.running = true
 
-	go func() {
-		defer h.device.Close()
+	for _, dev := range devices {
+		h.attach(dev)
+	}
 
-		buf := make([]byte, 24) // sizeof(struct input_event)
-		for h.running {
-			n, err := h.device.Read(buf)
-			if err != nil || n != 24 {
-				continue
-			}
+	// Follow keyboards being plugged in, unplugged or switched away by a KVM
+	h.watcher, err = newInputWatcher()
+	if err != nil {
+		fmt.Printf("Keyboard hotplug unavailable: %v\n", err)
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("failed to find keyboard device: %v", errNoKeyboard)
+		}
+	} else {
+		if len(devices) == 0 {
+			fmt.Println("No keyboard found yet, waiting for one to be connected")
+		}
+		go h.watcher.run(h.deviceAdded, h.deviceRemoved)
+	}
 
-			event := InputEvent{
-				Type:  binary.LittleEndian.Uint16(buf[16:18]),
-				Code:  binary.LittleEndian.Uint16(buf[18:20]),
-				Value: int32(binary.LittleEndian.Uint32(buf[20:24])),
-			}
+	return h.eventChan, nil
+}
+
+// attach grabs an opened keyboard and starts reading from it
+func (h *LinuxKeyboardHook) attach(dev *evdevDevice) {
+	if h.virtual != nil {
+		waitForKeysReleased(dev.file, 2*time.Second)
+		if err := grabDevice(dev.file, true); err != nil {
+			fmt.Printf("Failed to grab %s (%s): %v\n", dev.path, dev.name, err)
+		} else {
+			dev.grabbed = true
+		}
+	}
+
+	h.mu.Lock()
+	if !h.running || h.devices[dev.path] != nil {
+		h.mu.Unlock()
+		dev.file.Close()
+		return
+	}
+	h.devices[dev.path] = dev
+	h.readers.Add(1)
+	h.mu.Unlock()
+
+	if h.recorder != nil {
+		dev.recordID = h.recorder.device(dev.name)
+	}
+
+	fmt.Printf("Using keyboard %s (%s)\n", dev.path, dev.name)
+	h.applyLEDs(dev)
+	go h.readDevice(dev)
+}
+
+// detach forgets a keyboard and releases every key still held on it.
+// It reports whether the device was still attached.
+func (h *LinuxKeyboardHook) detach(dev *evdevDevice) bool {
+	h.mu.Lock()
+	attached := h.running && h.devices[dev.path] == dev
+	if attached {
+		delete(h.devices, dev.path)
+	}
+	h.mu.Unlock()
+
+	dev.file.Close()
+	if !attached {
+		return false
+	}
+
+	if h.recorder != nil {
+		h.recorder.removed(dev.recordID)
+	}
+
+	for code, key := range dev.consumed {
+		delete(dev.consumed, code)
+		h.send(KeyEvent{Keycode: key, EventType: KeyUp, RawCode: int64(code), Time: time.Now()})
+	}
+	return true
+}
+
+// deviceAdded is called by the watcher when an event node appears or changes permissions
+func (h *LinuxKeyboardHook) deviceAdded(path string) {
+	h.mu.Lock()
+	known := h.devices[path] != nil
+	h.mu.Unlock()
+	if known {
+		return
+	}
+
+	dev, err := openKeyboardDevice(path)
+	if err != nil {
+		return
+	}
+	h.attach(dev)
+}
+
+// deviceRemoved is called by the watcher when an event node disappears.
+// Closing the file makes its reader detach the device.
+func (h *LinuxKeyboardHook) deviceRemoved(path string) {
+	h.mu.Lock()
+	dev := h.devices[path]
+	h.mu.Unlock()
+	if dev != nil {
+		dev.file.Close()
+	}
+}
+
+// reopen tries to attach a keyboard again after its fd went bad while the
+// node stayed around, as happens with some devices across suspend/resume
+func (h *LinuxKeyboardHook) reopen(path string) {
+	delay := 100 * time.Millisecond
+	for attempt := 0; attempt < 6; attempt++ {
+		select {
+		case <-time.After(delay):
+		case <-h.stopChan:
+			return
+		}
+		delay *= 2
+
+		if _, err := os.Stat(path); err != nil {
+			return // Gone for good; the watcher picks it up if it returns
+		}
+		dev, err := openKeyboardDevice(path)
+		if err == nil {
+			h.attach(dev)
+			return
+		}
+	}
+}
 
-			if event.Type != EV_KEY {
-				continue
+// readDevice pumps events from one keyboard until it is closed or fails
+func (h *LinuxKeyboardHook) readDevice(dev *evdevDevice) {
+	defer h.readers.Done()
+
+	buf := make([]byte, 64*inputEventSize)
+	var events []InputEvent
+	for {
+		n, err := dev.file.Read(buf)
+		if err != nil {
+			if h.detach(dev) {
+				fmt.Printf("Lost keyboard %s (%s): %v\n", dev.path, dev.name, err)
+				go h.reopen(dev.path)
 			}
+			return
+		}
 
-			key := translateLinuxKeycode(uint32(event.Code))
-			if key == KeyUnknown {
-				continue
+		if h.recorder != nil {
+			h.recorder.events(dev.recordID, buf[:n])
+		}
+
+		// evdev only hands out whole events, as many as fit in buf
+		events = decodeInputEvents(buf[:n], inputEventSize, events[:0])
+		for _, event := range events {
+			if !h.handleEvent(dev, event) && dev.grabbed {
+				h.virtual.emit(event.Type, event.Code, event.Value)
 			}
+		}
+	}
+}
+
+// handleEvent forwards mapped keys to the event channel.
+// It returns true when the event was consumed and must not be passed through.
+func (h *LinuxKeyboardHook) handleEvent(dev *evdevDevice, event InputEvent) bool {
+	evt, deliver, consumed := translateInputEvent(dev.consumed, event, mc != nil && mc.IsActive())
+	if deliver {
+		h.send(evt)
+	}
+	return consumed
+}
+
+// translateInputEvent turns an evdev event from one device into a KeyEvent.
+// consumed holds that device's swallowed presses and active is the current
+// mouse mode. It reports whether evt should be delivered and whether the
+// event must be kept from the system.
+func translateInputEvent(consumed map[uint16]Key, event InputEvent, active bool) (evt KeyEvent, deliver, swallow bool) {
+	if event.Type != EV_KEY {
+		return evt, false, false
+	}
+
+	evt.RawCode = int64(event.Code)
+	evt.Time = event.Time
 
-			var evt KeyEvent
-			evt.RawCode = int64(event.Code)
-			evt.Keycode = key
-
-			switch event.Value {
-			case KEY_PRESSED:
-				if key == KeyToggle {
-					evt.EventType = FlagsChanged
-					h.eventChan <- evt
-				} else if mc != nil && mc.IsActive() {
-					evt.EventType = KeyDown
-					h.eventChan <- evt
-				}
-			case KEY_RELEASED:
-				if mc != nil && mc.IsActive() && key != KeyToggle {
-					evt.EventType = KeyUp
-					h.eventChan <- evt
-				}
+	// The toggle key never reaches the system, so its lock state (and LED)
+	// doesn't flip every time mouse mode is switched
+	if translateLinuxKeycode(uint32(event.Code)) == KeyToggle {
+		if event.Value == KEY_PRESSED {
+			evt.Keycode = KeyToggle
+			evt.EventType = FlagsChanged
+			return evt, true, true
+		}
+		return evt, false, true
+	}
+
+	switch event.Value {
+	case KEY_PRESSED:
+		key := translateLinuxKeycode(uint32(event.Code))
+		if key == KeyUnknown {
+			return evt, false, false
+		}
+		evt.Keycode = key
+		if active {
+			consumed[event.Code] = key
+			evt.EventType = KeyDown
+			return evt, true, true
+		}
+	case KEY_RELEASED:
+		key, ok := consumed[event.Code]
+		if !ok {
+			return evt, false, false
+		}
+		delete(consumed, event.Code)
+		evt.Keycode = key
+		evt.EventType = KeyUp
+		return evt, true, true
+	case KEY_REPEAT:
+		_, ok := consumed[event.Code]
+		return evt, false, ok
+	}
+	return evt, false, false
+}
+
+// send delivers an event unless the hook is shutting down
+func (h *LinuxKeyboardHook) send(evt KeyEvent) {
+	select {
+	case h.eventChan <- evt:
+	case <-h.stopChan:
+	}
+}
+
+// RecordInput saves every raw event read from the keyboards to file, for
+// replayInput. It must be called before Start.
+func (h *LinuxKeyboardHook) RecordInput(file io.WriteCloser) error {
+	recorder, err := newInputRecorder(file)
+	if err != nil {
+		return err
+	}
+	h.recorder = recorder
+	return nil
+}
+
+// SetModeIndicator lights the configured LED while mouse mode is active
+func (h *LinuxKeyboardHook) SetModeIndicator(active bool) {
+	h.mu.Lock()
+	h.indicator = active
+	h.mu.Unlock()
+	h.applyLEDsAll()
+}
+
+// readLEDs follows the LED state the system sets on the virtual keyboard.
+// While grabbed, the physical keyboards only get LED changes through us.
+func (h *LinuxKeyboardHook) readLEDs() {
+	buf := make([]byte, 16*inputEventSize)
+	var events []InputEvent
+	for {
+		n, err := h.virtual.Read(buf)
+		if err != nil {
+			return
+		}
+
+		events = decodeInputEvents(buf[:n], inputEventSize, events[:0])
+		changed := false
+		h.mu.Lock()
+		for _, event := range events {
+			if event.Type == EV_LED {
+				h.systemLEDs[event.Code] = event.Value != 0
+				changed = true
 			}
 		}
-	}()
+		h.mu.Unlock()
 
-	return h.eventChan, nil
+		if changed {
+			h.applyLEDsAll()
+		}
+	}
+}
+
+// ledState returns the LEDs a keyboard should show; the caller holds h.mu
+func (h *LinuxKeyboardHook) ledState() map[uint16]bool {
+	leds := map[uint16]bool{LED_NUML: false, LED_CAPSL: false, LED_SCROLLL: false}
+	for led, on := range h.systemLEDs {
+		leds[led] = on
+	}
+	if led, ok := indicatorLED(config.IndicatorLED); ok && h.indicator {
+		leds[led] = true
+	}
+	return leds
+}
+
+// applyLEDs writes the current LED state to one keyboard
+func (h *LinuxKeyboardHook) applyLEDs(dev *evdevDevice) {
+	if !dev.grabbed {
+		return // The system still drives this keyboard's LEDs itself
+	}
+	h.mu.Lock()
+	leds := h.ledState()
+	h.mu.Unlock()
+	setLEDs(dev.file, leds)
+}
+
+// applyLEDsAll writes the current LED state to every grabbed keyboard
+func (h *LinuxKeyboardHook) applyLEDsAll() {
+	h.mu.Lock()
+	leds := h.ledState()
+	var devices []*evdevDevice
+	for _, dev := range h.devices {
+		if dev.grabbed {
+			devices = append(devices, dev)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, dev := range devices {
+		setLEDs(dev.file, leds)
+	}
+}
+
+// indicatorLED maps the indicatorLed setting to an LED code
+func indicatorLED(name string) (uint16, bool) {
+	switch name {
+	case "caps":
+		return LED_CAPSL, true
+	case "scroll":
+		return LED_SCROLLL, true
+	case "num":
+		return LED_NUML, true
+	default:
+		return 0, false
+	}
 }
 
 func (h *LinuxKeyboardHook) Stop() error {
+	// Hand the keyboards back with the LEDs the system expects
+	h.SetModeIndicator(false)
+
+	h.mu.Lock()
 	h.running = false
-	if h.device != nil {
-		h.device.Close()
+	devices := h.devices
+	h.devices = make(map[string]*evdevDevice)
+	h.mu.Unlock()
+	close(h.stopChan)
+
+	if h.watcher != nil {
+		h.watcher.Close()
+	}
+	for _, dev := range devices {
+		if dev.grabbed {
+			grabDevice(dev.file, false)
+		}
+		dev.file.Close()
+	}
+
+	h.readers.Wait()
+	if h.virtual != nil {
+		h.virtual.Close()
+	}
+	if h.recorder != nil {
+		h.recorder.Close()
 	}
 	close(h.eventChan)
 	return nil
@@ -169,60 +500,87 @@ func translateLinuxKeycode(code uint32) Key {
 		return KeyScrollUp
 	case linuxKeyF:
 		return KeyScrollDown
+	case linuxKeyT:
+		return KeyScrollLeft
+	case linuxKeyG:
+		return KeyScrollRight
+	case linuxKeyC:
+		return KeyBack
+	case linuxKeyV:
+		return KeyForward
 	default:
-		return KeyUnknown
+		return boundKey(linuxKeyNames[code])
 	}
 }
 
-// findKeyboardDevice finds the first keyboard device in /dev/input
-func findKeyboardDevice() (string, error) {
-	// Try to find a keyboard in /dev/input/by-id
-	byIdPath := "/dev/input/by-id"
-	entries, err := os.ReadDir(byIdPath)
-	if err == nil {
-		for _, entry := range entries {
-			name := entry.Name()
-			if strings.Contains(name, "kbd") || strings.Contains(name, "keyboard") {
-				return filepath.Join(byIdPath, name), nil
-			}
+// linuxKeyNames names the letter, digit, Tab and Backspace keys, for the key bindings in the config
+var linuxKeyNames = func() map[uint32]string {
+	names := map[uint32]string{14: "backspace", 15: "tab"}
+	for first, row := range map[uint32]string{2: "1234567890", 16: "qwertyuiop", 30: "asdfghjkl", 44: "zxcvbnm"} {
+		for i, c := range row {
+			names[first+uint32(i)] = string(c)
 		}
 	}
+	return names
+}()
 
-	// Fallback: check /proc/bus/input/devices
-	devicesFile, err := os.Open("/proc/bus/input/devices")
+// errNoKeyboard is returned when /dev/input holds no usable keyboard
+var errNoKeyboard = errors.New("no keyboard found in /dev/input")
+
+// errNotKeyboard is returned by openKeyboardDevice for nodes that aren't selected keyboards
+var errNotKeyboard = errors.New("not a keyboard")
+
+// openKeyboardDevice opens an evdev node if the hook should use it.
+// Our own uinput devices are skipped.
+func openKeyboardDevice(path string) (*evdevDevice, error) {
+	// Write access lets us drive the LEDs; reading is enough for everything else
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		f, err = os.Open(path)
+	}
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer devicesFile.Close()
 
-	scanner := bufio.NewScanner(devicesFile)
-	var currentHandler string
-	isKeyboard := false
+	info := readInputDeviceInfo(path, f)
+	if !isSelectedKeyboard(info) {
+		f.Close()
+		return nil, errNotKeyboard
+	}
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	return &evdevDevice{
+		path:     path,
+		name:     info.name,
+		file:     f,
+		consumed: make(map[uint16]Key),
+	}, nil
+}
 
-		if strings.HasPrefix(line, "N: Name=") {
-			name := strings.ToLower(line)
-			isKeyboard = strings.Contains(name, "keyboard") || strings.Contains(name, "kbd")
-		}
+// openKeyboardDevices opens every evdev node the hook should use
+func openKeyboardDevices() ([]*evdevDevice, error) {
+	paths, err := eventDevicePaths()
+	if err != nil {
+		return nil, err
+	}
 
-		if strings.HasPrefix(line, "H: Handlers=") && isKeyboard {
-			parts := strings.Fields(line)
-			for _, part := range parts {
-				if strings.HasPrefix(part, "event") {
-					currentHandler = part
-					return "/dev/input/" + currentHandler, nil
-				}
+	var devices []*evdevDevice
+	var lastErr error
+	for _, path := range paths {
+		dev, err := openKeyboardDevice(path)
+		if err != nil {
+			if err != errNotKeyboard {
+				lastErr = err
 			}
+			continue
 		}
+		devices = append(devices, dev)
+	}
 
-		if line == "" {
-			isKeyboard = false
-			currentHandler = ""
+	if len(devices) == 0 {
+		if lastErr != nil {
+			return nil, fmt.Errorf("no readable keyboard in /dev/input: %v (try running as root or add user to 'input' group)", lastErr)
 		}
+		return nil, errNoKeyboard
 	}
-
-	// Last resort: try event0
-	return "/dev/input/event0", nil
+	return devices, nil
 }
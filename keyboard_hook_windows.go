@@ -3,7 +3,9 @@
 package main
 
 import (
+	"strings"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
@@ -36,7 +38,13 @@ const (
 	VK_X         = 0x58
 	VK_R         = 0x52
 	VK_F         = 0x46
+	VK_T         = 0x54
+	VK_G         = 0x47
+	VK_C         = 0x43
+	VK_V         = 0x56
 	VK_SPACE     = 0x20
+	VK_TAB       = 0x09
+	VK_BACK      = 0x08
 	VK_LCONTROL  = 0xA2
 	VK_LSHIFT    = 0xA0
 )
@@ -62,6 +70,7 @@ type MSG struct {
 var (
 	windowsEventChan chan KeyEvent
 	windowsHookHandle uintptr
+	windowsToggleDown bool
 )
 
 // WindowsKeyboardHook implements KeyboardHook for Windows
@@ -151,7 +160,23 @@ func translateWindowsKeycode(vkCode uint32) Key {
 		return KeyScrollUp
 	case VK_F:
 		return KeyScrollDown
+	case VK_T:
+		return KeyScrollLeft
+	case VK_G:
+		return KeyScrollRight
+	case VK_C:
+		return KeyBack
+	case VK_V:
+		return KeyForward
+	case VK_TAB:
+		return boundKey("tab")
+	case VK_BACK:
+		return boundKey("backspace")
 	default:
+		// Letter and digit keys have the same virtual key code as their uppercase ASCII
+		if vkCode >= '0' && vkCode <= '9' || vkCode >= 'A' && vkCode <= 'Z' {
+			return boundKey(strings.ToLower(string(rune(vkCode))))
+		}
 		return KeyUnknown
 	}
 }
@@ -165,14 +190,21 @@ func keyboardProc(nCode int, wParam uintptr, lParam uintptr) uintptr {
 		var evt KeyEvent
 		evt.RawCode = int64(kbStruct.VkCode)
 		evt.Keycode = key
+		evt.Time = time.Now()
 
 		switch wParam {
 		case WM_KEYDOWN, WM_SYSKEYDOWN:
 			if key == KeyToggle {
-				evt.EventType = FlagsChanged
-				if windowsEventChan != nil {
-					windowsEventChan <- evt
+				// Ignore autorepeat while the toggle key is held
+				if !windowsToggleDown {
+					windowsToggleDown = true
+					evt.EventType = FlagsChanged
+					if windowsEventChan != nil {
+						windowsEventChan <- evt
+					}
 				}
+				// Suppress it so the Caps Lock state doesn't flip with every toggle
+				return 1
 			} else if mc != nil && mc.IsActive() && key != KeyUnknown {
 				evt.EventType = KeyDown
 				if windowsEventChan != nil {
@@ -182,6 +214,10 @@ func keyboardProc(nCode int, wParam uintptr, lParam uintptr) uintptr {
 				return 1
 			}
 		case WM_KEYUP, WM_SYSKEYUP:
+			if key == KeyToggle {
+				windowsToggleDown = false
+				return 1
+			}
 			if mc != nil && mc.IsActive() && key != KeyUnknown && key != KeyToggle {
 				evt.EventType = KeyUp
 				if windowsEventChan != nil {
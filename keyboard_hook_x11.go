@@ -0,0 +1,378 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// X11 keysyms of the keys we use
+const (
+	xkCapsLock = 0xffe5
+	xkW        = 0x77
+	xkA        = 0x61
+	xkS        = 0x73
+	xkD        = 0x64
+	xkQ        = 0x71
+	xkE        = 0x65
+	xkZ        = 0x7a
+	xkX        = 0x78
+	xkR        = 0x72
+	xkF        = 0x66
+	xkT        = 0x74
+	xkG        = 0x67
+	xkC        = 0x63
+	xkV        = 0x76
+	xkSpace    = 0x20
+	xkTab      = 0xff09
+	xkBack     = 0xff08
+	xkLCtrl    = 0xffe3
+	xkLShift   = 0xffe1
+)
+
+// XKB requests used to put the Caps Lock state back; xgb has no XKB bindings
+const (
+	xkbUseExtension   = 0
+	xkbLatchLockState = 5
+	xkbUseCoreKbd     = 0x0100
+)
+
+// X11KeyboardHook implements KeyboardHook through the X server.
+// Unlike the evdev hook it needs no access to /dev/input: the toggle key is
+// taken with a passive XGrabKey, and the whole keyboard is actively grabbed
+// while mouse mode is on, following the controller through SetModeIndicator.
+// Keys without a mapping are swallowed during that time.
+type X11KeyboardHook struct {
+	display   string
+	conn      *xgb.Conn
+	root      xproto.Window
+	keys      map[xproto.Keycode]Key
+	pressed   map[xproto.Keycode]bool // guarded by mu
+	eventChan chan KeyEvent
+	stopChan  chan struct{}
+	done      chan struct{}
+	mu        sync.Mutex
+	running   bool
+
+	// xkbOpcode is the XKEYBOARD major opcode, 0 when it's unavailable, and
+	// capsLocked the Lock state when the toggle key went down
+	xkbOpcode  byte
+	capsLocked bool
+}
+
+// NewX11KeyboardHook creates a hook for the given X display ("" uses $DISPLAY)
+func NewX11KeyboardHook(display string) *X11KeyboardHook {
+	return &X11KeyboardHook{
+		display:   display,
+		pressed:   make(map[xproto.Keycode]bool),
+		eventChan: make(chan KeyEvent, 100),
+		stopChan:  make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+func (h *X11KeyboardHook) Start() (<-chan KeyEvent, error) {
+	conn, err := xgb.NewConnDisplay(h.display)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to X display: %v", err)
+	}
+
+	setup := xproto.Setup(conn)
+	h.conn = conn
+	h.root = setup.DefaultScreen(conn).Root
+
+	h.keys, err = x11KeyMap(conn, setup.MinKeycode, setup.MaxKeycode)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read X keyboard mapping: %v", err)
+	}
+
+	for code, key := range h.keys {
+		if key != KeyToggle {
+			continue
+		}
+		err := xproto.GrabKeyChecked(conn, false, h.root, xproto.ModMaskAny, code,
+			xproto.GrabModeAsync, xproto.GrabModeAsync).Check()
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to grab toggle key (is another program using it?): %v", err)
+		}
+	}
+
+	// The passive grab doesn't stop XKB from flipping Lock, so it is put
+	// back after each press of the toggle key
+	h.xkbOpcode, err = initXkb(conn)
+	if err != nil {
+		fmt.Printf("Caps Lock will still switch case under the X11 hook: %v\n", err)
+	}
+
+	h.mu.Lock()
+	h.running = true
+	h.mu.Unlock()
+
+	go h.run(h.conn)
+
+	return h.eventChan, nil
+}
+
+// x11EventSource is where run reads X events from, an *xgb.Conn outside tests
+type x11EventSource interface {
+	WaitForEvent() (xgb.Event, xgb.Error)
+	PollForEvent() (xgb.Event, xgb.Error)
+}
+
+// run reads X events until the connection is closed
+func (h *X11KeyboardHook) run(events x11EventSource) {
+	defer close(h.done)
+
+	var pending xgb.Event
+	for {
+		ev := pending
+		pending = nil
+		if ev == nil {
+			var xerr xgb.Error
+			ev, xerr = events.WaitForEvent()
+			if ev == nil && xerr == nil {
+				return // Connection closed
+			}
+			if xerr != nil {
+				continue
+			}
+		}
+
+		switch e := ev.(type) {
+		case xproto.KeyPressEvent:
+			h.keyPress(e)
+		case xproto.KeyReleaseEvent:
+			// X reports autorepeat as a release immediately followed by a
+			// press with the same timestamp; drop both halves of the pair.
+			next, _ := events.PollForEvent()
+			if press, ok := next.(xproto.KeyPressEvent); ok && press.Detail == e.Detail && press.Time == e.Time {
+				continue
+			}
+			pending = next
+			h.keyRelease(e)
+		}
+	}
+}
+
+func (h *X11KeyboardHook) keyPress(e xproto.KeyPressEvent) {
+	key, ok := h.keys[e.Detail]
+	if !ok {
+		return
+	}
+
+	evt := KeyEvent{Keycode: key, RawCode: int64(e.Detail), Flags: uint64(e.State), Time: time.Now()}
+	if key == KeyToggle {
+		h.capsLocked = e.State&xproto.ModMaskLock != 0
+		// The grab follows once the controller has toggled
+		evt.EventType = FlagsChanged
+		h.send(evt)
+		return
+	}
+
+	h.mu.Lock()
+	down := mc != nil && mc.IsActive() && !h.pressed[e.Detail]
+	if down {
+		h.pressed[e.Detail] = true
+	}
+	h.mu.Unlock()
+	if down {
+		evt.EventType = KeyDown
+		h.send(evt)
+	}
+}
+
+func (h *X11KeyboardHook) keyRelease(e xproto.KeyReleaseEvent) {
+	key, ok := h.keys[e.Detail]
+	if ok && key == KeyToggle {
+		// XKB has toggled Lock by the time the key is released
+		if h.xkbOpcode != 0 {
+			var locks uint8
+			if h.capsLocked {
+				locks = xproto.ModMaskLock
+			}
+			xkbLockModifiers(h.conn, h.xkbOpcode, xproto.ModMaskLock, locks)
+		}
+		return
+	}
+	h.mu.Lock()
+	up := ok && h.pressed[e.Detail]
+	delete(h.pressed, e.Detail)
+	h.mu.Unlock()
+	if !up {
+		return
+	}
+	h.send(KeyEvent{Keycode: key, EventType: KeyUp, RawCode: int64(e.Detail), Flags: uint64(e.State), Time: time.Now()})
+}
+
+// SetModeIndicator takes or releases the active keyboard grab that routes
+// every key to us while mouse mode is on
+func (h *X11KeyboardHook) SetModeIndicator(active bool) {
+	h.mu.Lock()
+	running := h.running
+	if !active {
+		// Releases now go to the focused window, so forget what was held
+		clear(h.pressed)
+	}
+	h.mu.Unlock()
+	if !running {
+		return
+	}
+	if !active {
+		xproto.UngrabKeyboard(h.conn, xproto.TimeCurrentTime)
+		return
+	}
+
+	// Another client (e.g. an open menu) may hold the keyboard briefly
+	for attempt := 0; attempt < 10; attempt++ {
+		reply, err := xproto.GrabKeyboard(h.conn, false, h.root, xproto.TimeCurrentTime,
+			xproto.GrabModeAsync, xproto.GrabModeAsync).Reply()
+		if err == nil && reply.Status == xproto.GrabStatusSuccess {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	fmt.Println("Failed to grab the X keyboard, only the toggle key will reach MouseKeys")
+}
+
+// send delivers an event unless the hook is shutting down
+func (h *X11KeyboardHook) send(evt KeyEvent) {
+	select {
+	case h.eventChan <- evt:
+	case <-h.stopChan:
+	}
+}
+
+func (h *X11KeyboardHook) Stop() error {
+	h.mu.Lock()
+	running := h.running
+	h.running = false
+	h.mu.Unlock()
+
+	if running {
+		close(h.stopChan)
+		h.conn.Close()
+		<-h.done
+	}
+	close(h.eventChan)
+	return nil
+}
+
+// initXkb enables XKB 1.0 on conn and returns its major opcode
+func initXkb(conn *xgb.Conn) (byte, error) {
+	ext, err := xproto.QueryExtension(conn, uint16(len("XKEYBOARD")), "XKEYBOARD").Reply()
+	if err != nil {
+		return 0, err
+	}
+	if !ext.Present {
+		return 0, errors.New("the X server has no XKEYBOARD extension")
+	}
+
+	// XkbUseExtension: wanted major and minor version
+	buf := make([]byte, 8)
+	buf[0] = ext.MajorOpcode
+	buf[1] = xkbUseExtension
+	xgb.Put16(buf[2:], uint16(len(buf)/4))
+	xgb.Put16(buf[4:], 1)
+	cookie := conn.NewCookie(true, true)
+	conn.NewRequest(buf, cookie)
+	reply, err := cookie.Reply()
+	if err != nil {
+		return 0, err
+	}
+	if len(reply) < 2 || reply[1] == 0 {
+		return 0, errors.New("the X server doesn't support XKB 1.0")
+	}
+	return ext.MajorOpcode, nil
+}
+
+// xkbLockModifiers sets the lock state of the modifiers in mask to locks on
+// the core keyboard, like XkbLockModifiers
+func xkbLockModifiers(conn *xgb.Conn, opcode byte, mask, locks uint8) {
+	// XkbLatchLockState, leaving the group and latches alone
+	buf := make([]byte, 16)
+	buf[0] = opcode
+	buf[1] = xkbLatchLockState
+	xgb.Put16(buf[2:], uint16(len(buf)/4))
+	xgb.Put16(buf[4:], xkbUseCoreKbd)
+	buf[6] = mask
+	buf[7] = locks
+	conn.NewRequest(buf, conn.NewCookie(false, false))
+}
+
+// x11KeyMap finds the keycodes that currently produce our keysyms
+func x11KeyMap(conn *xgb.Conn, min, max xproto.Keycode) (map[xproto.Keycode]Key, error) {
+	reply, err := xproto.GetKeyboardMapping(conn, min, byte(max-min+1)).Reply()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[xproto.Keycode]Key)
+	perCode := int(reply.KeysymsPerKeycode)
+	for i := 0; i*perCode < len(reply.Keysyms); i++ {
+		// The first keysym of each keycode is the unshifted one
+		if key := translateX11Keysym(reply.Keysyms[i*perCode]); key != KeyUnknown {
+			keys[min+xproto.Keycode(i)] = key
+		}
+	}
+	return keys, nil
+}
+
+// translateX11Keysym converts an X keysym to unified Key
+func translateX11Keysym(sym xproto.Keysym) Key {
+	switch sym {
+	case xkCapsLock:
+		return KeyToggle
+	case xkW:
+		return KeyMoveUp
+	case xkS:
+		return KeyMoveDown
+	case xkA:
+		return KeyMoveLeft
+	case xkD:
+		return KeyMoveRight
+	case xkQ:
+		return KeyDiagUpLeft
+	case xkE:
+		return KeyDiagUpRight
+	case xkZ:
+		return KeyDiagDownLeft
+	case xkX:
+		return KeyDiagDownRight
+	case xkSpace:
+		return KeyLeftClick
+	case xkLCtrl:
+		return KeyRightClick
+	case xkLShift:
+		return KeyMiddleClick
+	case xkR:
+		return KeyScrollUp
+	case xkF:
+		return KeyScrollDown
+	case xkT:
+		return KeyScrollLeft
+	case xkG:
+		return KeyScrollRight
+	case xkC:
+		return KeyBack
+	case xkV:
+		return KeyForward
+	case xkTab:
+		return boundKey("tab")
+	case xkBack:
+		return boundKey("backspace")
+	default:
+		// Latin letter and digit keysyms are their ASCII code
+		if sym >= '0' && sym <= '9' || sym >= 'a' && sym <= 'z' {
+			return boundKey(string(rune(sym)))
+		}
+		return KeyUnknown
+	}
+}
@@ -0,0 +1,150 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+func TestTranslateX11KeysymBindings(t *testing.T) {
+	tests := []struct {
+		sym  xproto.Keysym
+		want Key
+	}{
+		{xkCapsLock, KeyToggle},
+		{xkW, KeyMoveUp},
+		{xkTab, KeyPrecision},
+		{xkBack, KeyBisectUndo},
+		{'1', KeyTurbo},
+		{'b', KeyBisect},
+		{'5', KeyUnknown},
+	}
+	for _, tt := range tests {
+		if got := translateX11Keysym(tt.sym); got != tt.want {
+			t.Errorf("translateX11Keysym(%#x) = %v, want %v", tt.sym, got, tt.want)
+		}
+	}
+}
+
+// fakeX11Events replays a fixed list of X events, then reports the
+// connection closed
+type fakeX11Events struct {
+	events []xgb.Event
+}
+
+func (f *fakeX11Events) WaitForEvent() (xgb.Event, xgb.Error) {
+	return f.PollForEvent()
+}
+
+func (f *fakeX11Events) PollForEvent() (xgb.Event, xgb.Error) {
+	if len(f.events) == 0 {
+		return nil, nil
+	}
+	ev := f.events[0]
+	f.events = f.events[1:]
+	return ev, nil
+}
+
+func TestX11HookDropsAutorepeat(t *testing.T) {
+	defer func(saved *MouseController) { mc = saved }(mc)
+	mc, _ = newTestController()
+	mc.Toggle()
+
+	const codeA, codeW, codeD = 38, 25, 40
+	h := NewX11KeyboardHook("")
+	h.keys = map[xproto.Keycode]Key{codeA: KeyMoveLeft, codeW: KeyMoveUp, codeD: KeyMoveRight}
+	h.run(&fakeX11Events{events: []xgb.Event{
+		xproto.KeyPressEvent{Detail: codeA, Time: 1},
+		// Autorepeat: a release and a press with the same timestamp
+		xproto.KeyReleaseEvent{Detail: codeA, Time: 5},
+		xproto.KeyPressEvent{Detail: codeA, Time: 5},
+		xproto.KeyReleaseEvent{Detail: codeA, Time: 9},
+		// Rolling over to another key at the same time is not a repeat
+		xproto.KeyPressEvent{Detail: codeW, Time: 10},
+		xproto.KeyReleaseEvent{Detail: codeW, Time: 12},
+		xproto.KeyPressEvent{Detail: codeD, Time: 12},
+	}})
+
+	type change struct {
+		key Key
+		typ KeyEventType
+	}
+	var got []change
+	for len(h.eventChan) > 0 {
+		evt := <-h.eventChan
+		got = append(got, change{evt.Keycode, evt.EventType})
+	}
+	want := []change{
+		{KeyMoveLeft, KeyDown}, {KeyMoveLeft, KeyUp},
+		{KeyMoveUp, KeyDown}, {KeyMoveUp, KeyUp},
+		{KeyMoveRight, KeyDown},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+// TestX11KeyboardHookOnServer needs an X server, e.g. xvfb-run go test
+func TestX11KeyboardHookOnServer(t *testing.T) {
+	if os.Getenv("DISPLAY") == "" {
+		t.Skip("DISPLAY is not set")
+	}
+	conn, err := xgb.NewConnDisplay("")
+	if err != nil {
+		t.Skipf("no X server: %v", err)
+	}
+	defer conn.Close()
+	setup := xproto.Setup(conn)
+	root := setup.DefaultScreen(conn).Root
+
+	keys, err := x11KeyMap(conn, setup.MinKeycode, setup.MaxKeycode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []Key{KeyToggle, KeyMoveUp, KeyPrecision, KeyTurbo, KeyBisectUndo} {
+		found := false
+		for _, key := range keys {
+			found = found || key == want
+		}
+		if !found {
+			t.Errorf("Expected the keyboard mapping to have a key for %v", want)
+		}
+	}
+
+	h := NewX11KeyboardHook("")
+	if _, err := h.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Stop()
+
+	// Whether another client can take the keyboard tells if the hook holds it
+	otherCanGrab := func() bool {
+		// Round-trip so the hook's own requests have been handled
+		xproto.GetInputFocus(h.conn).Reply()
+		reply, err := xproto.GrabKeyboard(conn, false, root, xproto.TimeCurrentTime,
+			xproto.GrabModeAsync, xproto.GrabModeAsync).Reply()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply.Status == xproto.GrabStatusSuccess {
+			xproto.UngrabKeyboard(conn, xproto.TimeCurrentTime)
+			xproto.GetInputFocus(conn).Reply()
+			return true
+		}
+		return false
+	}
+
+	h.SetModeIndicator(true)
+	if otherCanGrab() {
+		t.Error("Expected the hook to grab the keyboard when mouse mode turns on")
+	}
+	h.SetModeIndicator(false)
+	if !otherCanGrab() {
+		t.Error("Expected the hook to release the keyboard when mouse mode turns off")
+	}
+}
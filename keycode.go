@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 // Key represents a unified key code across platforms
 type Key int
 
@@ -27,8 +29,45 @@ const (
 	KeyMiddleClick // Left Shift
 	KeyScrollUp    // R
 	KeyScrollDown  // F
+	KeyScrollLeft  // T
+	KeyScrollRight // G
+	KeyBack        // C
+	KeyForward     // V
+
+	// Speed modifiers, held; the keys are set in the config
+	KeyPrecision // Tab
+	KeyTurbo     // 1
+
+	// Bisection mode; the keys are set in the config
+	KeyBisect     // B
+	KeyBisectUndo // Backspace
 )
 
+// keyButtonBase+n is the action that holds mouse button n, see ButtonKey
+const keyButtonBase Key = 1000
+
+// ButtonKey returns the action that holds mouse button n while its key is down
+func ButtonKey(n MouseButton) Key {
+	return keyButtonBase + Key(n)
+}
+
+// Button returns the mouse button a key holds down, for the back, forward
+// and numbered button actions
+func (k Key) Button() (MouseButton, bool) {
+	switch {
+	case k == KeyBack:
+		return ButtonBack, true
+	case k == KeyForward:
+		return ButtonForward, true
+	case k > keyButtonBase && k <= keyButtonBase+maxMouseButton:
+		return MouseButton(k - keyButtonBase), true
+	}
+	return 0, false
+}
+
+// keyDirectionBase+n is the nth movement direction bound in the config
+const keyDirectionBase Key = 2000
+
 // KeyEventType represents the type of keyboard event
 type KeyEventType int
 
@@ -42,6 +81,7 @@ const (
 type KeyEvent struct {
 	Keycode   Key
 	EventType KeyEventType
-	RawCode   int64  // Platform-specific raw keycode
-	Flags     uint64 // Platform-specific modifier flags
+	RawCode   int64     // Platform-specific raw keycode
+	Flags     uint64    // Platform-specific modifier flags
+	Time      time.Time // When the key changed; the kernel timestamp where the platform provides one
 }
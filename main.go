@@ -1,42 +1,118 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/getlantern/systray"
-	"github.com/go-vgo/robotgo"
 )
 
 const (
-	slowSpeed     = 2.0   // Precision speed (shift or first 150ms)
-	normalSpeed   = 15.0  // Normal speed
-	precisionTime = 0.15  // 150ms precision phase
-	tickInterval  = 16 * time.Millisecond
-	scrollAmount  = 50
+	slowSpeed   = 125.0 // Starting speed of the Normal profile in px/s
+	normalSpeed = 940.0 // Full speed of the Normal profile in px/s
+
+	maxTickCatchUp = 250 * time.Millisecond // Longer stalls (suspend) aren't made up for
+	minGlideSpeed  = 30.0                   // A glide stops below this speed in px/s
+
+	analogScrollRate = 20.0 // Scroll steps per second at full stick deflection
 )
 
 type MouseController struct {
 	mu            sync.Mutex
 	active        bool
 	moveStartTime time.Time
+	// Key direction when last moved, to restart acceleration on sharp turns
+	moveDirX, moveDirY float64
+
+	// Movement keys being held, in the order they went down, and when
+	moveOrder     []Key
+	movePressTime map[Key]time.Time
+
+	// Whole pixels still to move for taps of the movement keys
+	nudgeX, nudgeY int
+
+	// Bisection mode: movement keys cut bisectRegion in half instead of
+	// moving, and bisectHistory holds the regions before each cut
+	bisecting     bool
+	bisectRegion  region
+	bisectHistory []region
+
+	// Speed modifier keys being held
+	precisionHeld, turboHeld bool
+
+	// Velocity in px/s the pointer keeps gliding at once the movement keys
+	// are released, and whether the keys now held are braking a glide
+	glideX, glideY float64
+	braking        bool
+
+	// Continuous input from analog sticks, -1..1 per axis
+	analogX, analogY float64
+	scrollX, scrollY float64
 
-	keyW, keyA, keyS, keyD bool
-	keyQ, keyE, keyZ, keyX bool
+	// Held scroll keys, and when the first of them went down
+	scrollUp, scrollDown, scrollLeft, scrollRight bool
+	scrollStartTime                               time.Time
+
+	// Scroll not emitted yet, in notches
+	scrollAccX, scrollAccY float64
+
+	// Fraction of a pixel moved but not applied yet, per axis
+	moveRemX, moveRemY float64
+
+	// When tick last ran, to move by the time that really passed
+	lastTick time.Time
+
+	// Speed factor for the monitor under the pointer, and the monitor
+	// layout it was picked from; the layout is only used by tick
+	speedScale   float64
+	monitors     []Monitor
+	monitorsRead time.Time
 
 	leftDown bool
+
+	// Back, forward and numbered buttons being held
+	heldButtons map[MouseButton]bool
+
+	pointer PointerBackend
+	profile AccelerationProfile
+
+	// now is the controller's clock, replaced when replaying recorded input
+	now func() time.Time
 }
 
 var (
-	mc              *MouseController
-	hook            KeyboardHook
-	autostart       Autostart
-	speedMultiplier = 1.0
+	mc        *MouseController
+	hook      KeyboardHook
+	autostart Autostart
+	config    = DefaultConfig()
 )
 
-func NewMouseController() *MouseController {
-	return &MouseController{}
+// NewMouseController creates a controller that drives the given pointer
+func NewMouseController(pointer PointerBackend) *MouseController {
+	// loadConfig has made sure the profile exists
+	profile, _ := config.Acceleration.profile(config.Acceleration.Profile)
+	return &MouseController{
+		pointer:     pointer,
+		profile:     profile,
+		speedScale:  1,
+		heldButtons: make(map[MouseButton]bool),
+		now:         time.Now,
+
+		movePressTime: make(map[Key]time.Time),
+	}
+}
+
+// SetProfile changes how the pointer accelerates
+func (mc *MouseController) SetProfile(profile AccelerationProfile) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.profile = profile
 }
 
 func (mc *MouseController) Toggle() {
@@ -48,11 +124,21 @@ func (mc *MouseController) Toggle() {
 		mc.moveStartTime = time.Time{}
 	} else {
 		if mc.leftDown {
-			robotgo.Toggle("left", "up")
+			mc.pointer.Release(ButtonLeft)
 			mc.leftDown = false
 		}
-		mc.keyW, mc.keyA, mc.keyS, mc.keyD = false, false, false, false
-		mc.keyQ, mc.keyE, mc.keyZ, mc.keyX = false, false, false, false
+		for button := range mc.heldButtons {
+			mc.pointer.Release(button)
+			delete(mc.heldButtons, button)
+		}
+		mc.moveOrder = mc.moveOrder[:0]
+		clear(mc.movePressTime)
+		mc.nudgeX, mc.nudgeY = 0, 0
+		mc.bisecting, mc.bisectHistory = false, nil
+		mc.precisionHeld, mc.turboHeld = false, false
+		mc.glideX, mc.glideY, mc.braking = 0, 0, false
+		mc.scrollUp, mc.scrollDown, mc.scrollLeft, mc.scrollRight = false, false, false, false
+		mc.scrollAccX, mc.scrollAccY = 0, 0
 	}
 }
 
@@ -64,6 +150,11 @@ func (mc *MouseController) IsActive() bool {
 
 // HandleKeyDownByKey processes a key press using the unified Key type
 func (mc *MouseController) HandleKeyDownByKey(key Key) bool {
+	return mc.keyDown(key, mc.now())
+}
+
+// keyDown processes a key press that happened at the given time
+func (mc *MouseController) keyDown(key Key, at time.Time) bool {
 	mc.mu.Lock()
 	defer mc.mu.Unlock()
 
@@ -71,48 +162,62 @@ func (mc *MouseController) HandleKeyDownByKey(key Key) bool {
 		return false
 	}
 
-	switch key {
-	case KeyMoveUp:
-		mc.keyW = true
-		return true
-	case KeyMoveLeft:
-		mc.keyA = true
-		return true
-	case KeyMoveDown:
-		mc.keyS = true
-		return true
-	case KeyMoveRight:
-		mc.keyD = true
-		return true
-	case KeyDiagUpLeft:
-		mc.keyQ = true
-		return true
-	case KeyDiagUpRight:
-		mc.keyE = true
-		return true
-	case KeyDiagDownLeft:
-		mc.keyZ = true
-		return true
-	case KeyDiagDownRight:
-		mc.keyX = true
+	// Any key stops a glide; a movement key against it also brakes
+	if !mc.moveKeysHeld() {
+		x, y, ok := moveKeyDirection(key)
+		mc.braking = ok && config.Inertia.Enabled && x*mc.glideX+y*mc.glideY < 0
+		mc.glideX, mc.glideY = 0, 0
+	}
+
+	if dx, dy, ok := moveKeyDirection(key); ok {
+		if !slices.Contains(mc.moveOrder, key) {
+			mc.moveOrder = append(mc.moveOrder, key)
+			mc.movePressTime[key] = at
+			if mc.bisecting {
+				mc.bisect(dx, dy)
+			}
+		}
 		return true
+	}
+
+	switch key {
 	case KeyLeftClick:
 		if !mc.leftDown {
-			robotgo.Toggle("left", "down")
+			mc.pointer.Press(ButtonLeft)
 			mc.leftDown = true
 		}
 		return true
 	case KeyRightClick:
-		robotgo.Click("right", false)
+		mc.pointer.Click(ButtonRight)
 		return true
 	case KeyMiddleClick:
-		robotgo.Click("center", false)
+		mc.pointer.Click(ButtonMiddle)
 		return true
-	case KeyScrollUp:
-		robotgo.Scroll(0, scrollAmount)
+	case KeyScrollUp, KeyScrollDown, KeyScrollLeft, KeyScrollRight:
+		mc.pressScroll(key)
 		return true
-	case KeyScrollDown:
-		robotgo.Scroll(0, -scrollAmount)
+	case KeyPrecision:
+		mc.precisionHeld = true
+		return true
+	case KeyTurbo:
+		mc.turboHeld = true
+		return true
+	case KeyBisect:
+		mc.toggleBisect()
+		return true
+	case KeyBisectUndo:
+		if mc.bisecting {
+			mc.undoBisect()
+		}
+		return true
+	}
+
+	// Back, forward and numbered buttons stay down while their key is held
+	if button, ok := key.Button(); ok {
+		if !mc.heldButtons[button] {
+			mc.pointer.Press(button)
+			mc.heldButtons[button] = true
+		}
 		return true
 	}
 	return false
@@ -120,6 +225,11 @@ func (mc *MouseController) HandleKeyDownByKey(key Key) bool {
 
 // HandleKeyUpByKey processes a key release using the unified Key type
 func (mc *MouseController) HandleKeyUpByKey(key Key) bool {
+	return mc.keyUp(key, mc.now())
+}
+
+// keyUp processes a key release that happened at the given time
+func (mc *MouseController) keyUp(key Key, at time.Time) bool {
 	mc.mu.Lock()
 	defer mc.mu.Unlock()
 
@@ -127,41 +237,48 @@ func (mc *MouseController) HandleKeyUpByKey(key Key) bool {
 		return false
 	}
 
-	switch key {
-	case KeyMoveUp:
-		mc.keyW = false
+	if x, y, ok := moveKeyDirection(key); ok {
+		// A tap that never started continuous movement steps by the nudge distance
+		if pressed, held := mc.movePressTime[key]; held && mc.nudging() && mc.moveStartTime.IsZero() && !mc.braking && !mc.bisecting &&
+			at.Sub(pressed) < config.Nudge.holdTime() {
+			mc.nudgeX += int(math.Round(x * float64(config.Nudge.Distance)))
+			mc.nudgeY += int(math.Round(y * float64(config.Nudge.Distance)))
+		}
+		mc.moveOrder = slices.DeleteFunc(mc.moveOrder, func(k Key) bool { return k == key })
+		delete(mc.movePressTime, key)
 		return true
-	case KeyMoveLeft:
-		mc.keyA = false
+	}
+
+	switch key {
+	case KeyLeftClick:
+		if mc.leftDown {
+			mc.pointer.Release(ButtonLeft)
+			mc.leftDown = false
+		}
 		return true
-	case KeyMoveDown:
-		mc.keyS = false
+	case KeyMiddleClick:
 		return true
-	case KeyMoveRight:
-		mc.keyD = false
+	case KeyScrollUp, KeyScrollDown, KeyScrollLeft, KeyScrollRight:
+		mc.releaseScroll(key)
 		return true
-	case KeyDiagUpLeft:
-		mc.keyQ = false
+	case KeyRightClick:
 		return true
-	case KeyDiagUpRight:
-		mc.keyE = false
+	case KeyPrecision:
+		mc.precisionHeld = false
 		return true
-	case KeyDiagDownLeft:
-		mc.keyZ = false
+	case KeyTurbo:
+		mc.turboHeld = false
 		return true
-	case KeyDiagDownRight:
-		mc.keyX = false
+	case KeyBisect, KeyBisectUndo:
 		return true
-	case KeyLeftClick:
-		if mc.leftDown {
-			robotgo.Toggle("left", "up")
-			mc.leftDown = false
+	}
+
+	if button, ok := key.Button(); ok {
+		if mc.heldButtons[button] {
+			mc.pointer.Release(button)
+			delete(mc.heldButtons, button)
 		}
 		return true
-	case KeyMiddleClick:
-		return true
-	case KeyRightClick, KeyScrollUp, KeyScrollDown:
-		return true
 	}
 	return false
 }
@@ -212,114 +329,404 @@ func legacyKeycodeToKey(keycode int64) Key {
 		return KeyScrollUp
 	case 3: // F
 		return KeyScrollDown
+	case 17: // T
+		return KeyScrollLeft
+	case 5: // G
+		return KeyScrollRight
+	case 8: // C
+		return KeyBack
+	case 9: // V
+		return KeyForward
 	default:
 		return KeyUnknown
 	}
 }
 
-func (mc *MouseController) GetMovement() (dx, dy float64) {
+// SetAnalogMove sets the pointer velocity from an analog stick.
+// Full deflection moves at normal speed; keys add on top.
+func (mc *MouseController) SetAnalogMove(x, y float64) {
 	mc.mu.Lock()
 	defer mc.mu.Unlock()
+	mc.analogX, mc.analogY = x, y
+}
 
-	if !mc.active {
-		return 0, 0
+// SetAnalogScroll sets the scroll velocity from an analog stick (positive y scrolls up)
+func (mc *MouseController) SetAnalogScroll(x, y float64) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.scrollX, mc.scrollY = x, y
+}
+
+// scrollKey returns the held flag of a scroll key and its direction
+// (positive y is up, positive x is right); the caller holds mc.mu
+func (mc *MouseController) scrollKey(key Key) (held *bool, x, y float64) {
+	switch key {
+	case KeyScrollUp:
+		return &mc.scrollUp, 0, 1
+	case KeyScrollDown:
+		return &mc.scrollDown, 0, -1
+	case KeyScrollLeft:
+		return &mc.scrollLeft, -1, 0
+	default:
+		return &mc.scrollRight, 1, 0
 	}
+}
 
-	// Get input direction
-	inputX, inputY := 0.0, 0.0
-	if mc.keyW {
-		inputY -= 1
+// pressScroll starts scrolling while a scroll key is held. One step goes
+// out right away so a tap still scrolls; the caller holds mc.mu.
+func (mc *MouseController) pressScroll(key Key) {
+	held, x, y := mc.scrollKey(key)
+	if *held {
+		return // Autorepeat
 	}
-	if mc.keyS {
-		inputY += 1
+	if !mc.scrollUp && !mc.scrollDown && !mc.scrollLeft && !mc.scrollRight {
+		mc.scrollStartTime = mc.now()
 	}
-	if mc.keyA {
-		inputX -= 1
+	*held = true
+	mc.scrollAccX += x * config.Scroll.Step
+	mc.scrollAccY += y * config.Scroll.Step
+}
+
+// releaseScroll stops scrolling for a key; the caller holds mc.mu
+func (mc *MouseController) releaseScroll(key Key) {
+	held, _, _ := mc.scrollKey(key)
+	*held = false
+	if !mc.scrollUp && !mc.scrollDown && !mc.scrollLeft && !mc.scrollRight {
+		// Whole steps still go out, but leftover fractions would make
+		// the next tap scroll one step too far
+		mc.scrollAccX -= math.Mod(mc.scrollAccX, 1)
+		mc.scrollAccY -= math.Mod(mc.scrollAccY, 1)
 	}
-	if mc.keyD {
-		inputX += 1
+}
+
+// addScrollDue adds the scrolling due over elapsed from the sticks and the
+// held scroll keys to the accumulators; the caller holds mc.mu
+func (mc *MouseController) addScrollDue(elapsed time.Duration) {
+	vx := mc.scrollX * analogScrollRate
+	vy := mc.scrollY * analogScrollRate
+
+	if mc.scrollUp || mc.scrollDown || mc.scrollLeft || mc.scrollRight {
+		rate := scrollKeyRate(mc.now().Sub(mc.scrollStartTime).Seconds(), config.Scroll)
+		for _, key := range []Key{KeyScrollUp, KeyScrollDown, KeyScrollLeft, KeyScrollRight} {
+			if held, x, y := mc.scrollKey(key); *held {
+				vx += x * rate
+				vy += y * rate
+			}
+		}
 	}
-	if mc.keyQ {
-		inputX -= 0.707
-		inputY -= 0.707
+
+	mc.scrollAccX += vx * elapsed.Seconds()
+	mc.scrollAccY += vy * elapsed.Seconds()
+}
+
+// GetScroll returns the whole notches to scroll for the time elapsed since
+// the last call, carrying fractions over
+func (mc *MouseController) GetScroll(elapsed time.Duration) (dx, dy int) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if !mc.active {
+		return 0, 0
 	}
-	if mc.keyE {
-		inputX += 0.707
-		inputY -= 0.707
+
+	mc.addScrollDue(elapsed)
+	dx, dy = int(mc.scrollAccX), int(mc.scrollAccY)
+	mc.scrollAccX -= float64(dx)
+	mc.scrollAccY -= float64(dy)
+	return dx, dy
+}
+
+// GetScrollHighRes returns the notches to scroll for the time elapsed since
+// the last call, fractions included
+func (mc *MouseController) GetScrollHighRes(elapsed time.Duration) (dx, dy float64) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if !mc.active {
+		return 0, 0
 	}
-	if mc.keyZ {
-		inputX -= 0.707
-		inputY += 0.707
+
+	mc.addScrollDue(elapsed)
+	dx, dy = mc.scrollAccX, mc.scrollAccY
+	mc.scrollAccX, mc.scrollAccY = 0, 0
+	return dx, dy
+}
+
+// GetMovement returns how far to move the pointer, in pixels, over the
+// time elapsed since the last call
+func (mc *MouseController) GetMovement(elapsed time.Duration) (dx, dy float64) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if !mc.active {
+		return 0, 0
+	}
+
+	// The speed modifiers apply on top of the profile, at any point of a move
+	scale := mc.speedScale
+	if mc.precisionHeld {
+		scale *= config.Precision.Scale
 	}
-	if mc.keyX {
-		inputX += 0.707
-		inputY += 0.707
+	if mc.turboHeld {
+		scale *= config.Turbo.Scale
 	}
 
-	// No movement
+	// Analog input is proportional and needs no acceleration phase
+	seconds := elapsed.Seconds()
+	analogDx := mc.analogX * fullSpeed(mc.profile) * scale * seconds
+	analogDy := mc.analogY * fullSpeed(mc.profile) * scale * seconds
+
+	inputX, inputY := mc.moveInput()
+
+	// No key movement
 	if inputX == 0 && inputY == 0 {
 		mc.moveStartTime = time.Time{}
+		mc.braking = false
+		glideDx, glideDy := mc.glide(seconds)
+		return analogDx + glideDx, analogDy + glideDy
+	}
+
+	// Keys braking a glide hold the pointer still until they're released,
+	// fresh presses wait to tell a nudge tap from a hold, and in bisection
+	// mode the keys only cut
+	if mc.braking || mc.bisecting || mc.nudging() && mc.moveStartTime.IsZero() &&
+		mc.now().Sub(mc.movePressTime[mc.moveOrder[0]]) < config.Nudge.holdTime() {
+		return analogDx, analogDy
+	}
+
+	// Start timing when we begin moving, and again when turning by 90° or
+	// more, so a change of direction starts out precise
+	if mc.moveStartTime.IsZero() || inputX*mc.moveDirX+inputY*mc.moveDirY <= 0 {
+		mc.moveStartTime = mc.now()
+	}
+	mc.moveDirX, mc.moveDirY = inputX, inputY
+
+	held := mc.now().Sub(mc.moveStartTime).Seconds()
+	speed := mc.profile.Speed(held) * scale
+
+	mc.glideX, mc.glideY = inputX*speed, inputY*speed
+	return analogDx + mc.glideX*seconds, analogDy + mc.glideY*seconds
+}
+
+// glide returns the distance a released flick carries the pointer over the
+// given seconds, slowing it down by the configured friction; the caller
+// holds mc.mu
+func (mc *MouseController) glide(seconds float64) (dx, dy float64) {
+	if !config.Inertia.Enabled {
+		mc.glideX, mc.glideY = 0, 0
 		return 0, 0
 	}
 
-	// Start timing when we begin moving
-	if mc.moveStartTime.IsZero() {
-		mc.moveStartTime = time.Now()
+	decay := math.Exp(-config.Inertia.Friction * seconds)
+	mc.glideX *= decay
+	mc.glideY *= decay
+	if math.Hypot(mc.glideX, mc.glideY) < minGlideSpeed {
+		mc.glideX, mc.glideY = 0, 0
 	}
+	return mc.glideX * seconds, mc.glideY * seconds
+}
 
-	elapsed := time.Since(mc.moveStartTime).Seconds()
+// nudging reports whether taps of the movement keys nudge the pointer
+func (mc *MouseController) nudging() bool {
+	return config.Nudge.Distance > 0
+}
 
-	// Speed selection: slow during precision phase, then normal
-	var speed float64
-	if elapsed < precisionTime {
-		speed = slowSpeed
-	} else {
-		speed = normalSpeed
+// Nudge moves the pointer by an exact number of pixels on the next tick
+func (mc *MouseController) Nudge(dx, dy int) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.nudgeX += dx
+	mc.nudgeY += dy
+}
+
+// takeNudge returns the pending nudges and clears them
+func (mc *MouseController) takeNudge() (dx, dy int) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	dx, dy = mc.nudgeX, mc.nudgeY
+	mc.nudgeX, mc.nudgeY = 0, 0
+	return dx, dy
+}
+
+// moveKeysHeld reports whether any movement key is down; the caller holds mc.mu
+func (mc *MouseController) moveKeysHeld() bool {
+	return len(mc.moveOrder) > 0
+}
+
+// moveInput combines the held movement keys into a unit direction, or 0,0.
+// Keys pulling opposite ways along an axis are settled by config.SOCD:
+// "neutral" cancels the axis, "last" and "first" let the latest or the
+// earliest of them have it alone. The rest add up, so W and Q together
+// head halfway between up and up-left.
+func (mc *MouseController) moveInput() (x, y float64) {
+	// The sign each axis resolves to, or 0 when neutral cancelled it
+	resolve := func(component func(dx, dy float64) float64) float64 {
+		sign, conflict := 0.0, false
+		for _, key := range mc.moveOrder {
+			dx, dy, _ := moveKeyDirection(key)
+			c := component(dx, dy)
+			if c == 0 {
+				continue
+			}
+			if sign != 0 && math.Copysign(1, c) != sign {
+				conflict = true
+			}
+			if sign == 0 || config.SOCD == "last" {
+				sign = math.Copysign(1, c)
+			}
+		}
+		if conflict && config.SOCD == "neutral" {
+			return 0
+		}
+		return sign
 	}
-	speed *= speedMultiplier
+	signX := resolve(func(dx, dy float64) float64 { return dx })
+	signY := resolve(func(dx, dy float64) float64 { return dy })
 
-	// Normalize diagonal
-	if inputX != 0 && inputY != 0 {
-		inputX *= 0.707
-		inputY *= 0.707
+	for _, key := range mc.moveOrder {
+		dx, dy, _ := moveKeyDirection(key)
+		if dx*signX > 0 {
+			x += dx
+		}
+		if dy*signY > 0 {
+			y += dy
+		}
 	}
 
-	return inputX * speed, inputY * speed
+	if length := math.Hypot(x, y); length > 0 {
+		return x / length, y / length
+	}
+	return 0, 0
 }
 
 func (mc *MouseController) RunLoop() {
-	ticker := time.NewTicker(tickInterval)
+	ticker := time.NewTicker(config.tickInterval())
 	defer ticker.Stop()
 
-	screenW, screenH := robotgo.GetScreenSize()
-
 	for range ticker.C {
-		dx, dy := mc.GetMovement()
-		if dx == 0 && dy == 0 {
-			continue
-		}
+		mc.tick()
+	}
+}
 
-		x, y := robotgo.Location()
-		newX := x + int(dx)
-		newY := y + int(dy)
+// tick scrolls and moves the pointer by what is due since the last tick
+func (mc *MouseController) tick() {
+	elapsed := mc.sinceLastTick()
+
+	// With speedScale on, a moving tick reads the position up front to take
+	// the speed from the monitor under the pointer, then moves from there
+	var x, y int
+	located := false
+	if config.SpeedScale != "none" && mc.isMoving() {
+		x, y = mc.pointer.Location()
+		located = true
+		mc.updateSpeedScale(x, y)
+	}
 
-		if newX < 0 {
-			newX = 0
-		} else if newX >= screenW {
-			newX = screenW - 1
-		}
-		if newY < 0 {
-			newY = 0
-		} else if newY >= screenH {
-			newY = screenH - 1
+	if hires, ok := mc.pointer.(HighResScroller); ok {
+		if sx, sy := mc.GetScrollHighRes(elapsed); sx != 0 || sy != 0 {
+			hires.ScrollHighRes(sx, sy)
 		}
+	} else if sx, sy := mc.GetScroll(elapsed); sx != 0 || sy != 0 {
+		mc.pointer.Scroll(sx, sy)
+	}
+
+	dx, dy := mc.pixelsDue(mc.GetMovement(elapsed))
+	nudgeX, nudgeY := mc.takeNudge()
+	dx, dy = dx+nudgeX, dy+nudgeY
+	if dx == 0 && dy == 0 {
+		return
+	}
 
-		robotgo.Move(newX, newY)
+	// Relative devices leave keeping the pointer on screen to the system
+	if rel, ok := mc.pointer.(RelativePointer); ok {
+		rel.MoveRelative(dx, dy)
+		return
 	}
+
+	if !located {
+		x, y = mc.pointer.Location()
+	}
+	screenW, screenH := mc.pointer.ScreenSize()
+	mc.pointer.Move(clampToScreen(x+dx, y+dy, screenW, screenH))
 }
 
-// processKeyEvent handles incoming keyboard events from the hook
-func processKeyEvent(evt KeyEvent) {
+// isMoving reports whether movement keys, a stick or a glide may move the
+// pointer this tick
+func (mc *MouseController) isMoving() bool {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.active && (len(mc.moveOrder) > 0 || mc.analogX != 0 || mc.analogY != 0 || mc.glideX != 0 || mc.glideY != 0)
+}
+
+// updateSpeedScale adjusts the speed to the monitor at x, y
+func (mc *MouseController) updateSpeedScale(x, y int) {
+	if now := mc.now(); mc.monitors == nil || now.Sub(mc.monitorsRead) >= monitorRefresh {
+		mc.monitors = listMonitors(mc.pointer)
+		mc.monitorsRead = now
+	}
+	scale := speedScale(monitorAt(mc.monitors, x, y), config.SpeedScale)
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.speedScale = scale
+}
+
+// sinceLastTick returns the time to move by this tick. A late tick makes
+// up for the delay, so the speed doesn't depend on the ticker keeping up.
+func (mc *MouseController) sinceLastTick() time.Duration {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	now := mc.now()
+	elapsed := config.tickInterval()
+	if !mc.lastTick.IsZero() {
+		elapsed = min(now.Sub(mc.lastTick), maxTickCatchUp)
+	}
+	mc.lastTick = now
+	return max(elapsed, 0)
+}
+
+// pixelsDue adds a tick's movement to the sub-pixel remainders and returns
+// the whole pixels to move, so slow and diagonal motion keeps its speed
+func (mc *MouseController) pixelsDue(dx, dy float64) (int, int) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if dx == 0 && dy == 0 {
+		mc.moveRemX, mc.moveRemY = 0, 0
+		return 0, 0
+	}
+	mc.moveRemX += dx
+	mc.moveRemY += dy
+	px, py := math.Trunc(mc.moveRemX), math.Trunc(mc.moveRemY)
+	mc.moveRemX -= px
+	mc.moveRemY -= py
+	return int(px), int(py)
+}
+
+// WarpTo moves the pointer straight to a screen position
+func (mc *MouseController) WarpTo(x, y int) {
+	screenW, screenH := mc.pointer.ScreenSize()
+	mc.pointer.Move(clampToScreen(x, y, screenW, screenH))
+}
+
+// clampToScreen keeps a pointer position on a screen of the given size
+func clampToScreen(x, y, screenW, screenH int) (int, int) {
+	if x < 0 {
+		x = 0
+	} else if x >= screenW {
+		x = screenW - 1
+	}
+	if y < 0 {
+		y = 0
+	} else if y >= screenH {
+		y = screenH - 1
+	}
+	return x, y
+}
+
+// HandleKeyEvent applies a keyboard event from a hook
+func (mc *MouseController) HandleKeyEvent(evt KeyEvent) {
 	switch evt.EventType {
 	case FlagsChanged:
 		if evt.Keycode == KeyToggle {
@@ -329,9 +736,28 @@ func processKeyEvent(evt KeyEvent) {
 			mc.HandleKeyDownByKey(evt.Keycode)
 		}
 	case KeyDown:
-		mc.HandleKeyDownByKey(evt.Keycode)
+		mc.keyDown(evt.Keycode, mc.eventTime(evt))
 	case KeyUp:
-		mc.HandleKeyUpByKey(evt.Keycode)
+		mc.keyUp(evt.Keycode, mc.eventTime(evt))
+	}
+}
+
+// eventTime is when a key event happened, so queueing delays don't turn a
+// nudge tap into a hold. Events without a timestamp count as happening now.
+func (mc *MouseController) eventTime(evt KeyEvent) time.Time {
+	if evt.Time.IsZero() {
+		return mc.now()
+	}
+	return evt.Time
+}
+
+// processKeyEvent handles incoming keyboard events from the hook
+func processKeyEvent(evt KeyEvent) {
+	mc.HandleKeyEvent(evt)
+	if evt.EventType == FlagsChanged && evt.Keycode == KeyToggle {
+		if indicator, ok := hook.(ModeIndicator); ok {
+			indicator.SetModeIndicator(mc.IsActive())
+		}
 	}
 }
 
@@ -343,13 +769,16 @@ func onReady() {
 	mStatus.Disable()
 	systray.AddSeparator()
 
-	// Speed submenu
-	mSpeed := systray.AddMenuItem("Speed: Normal", "Adjust mouse speed")
-	mSpeedSlow := mSpeed.AddSubMenuItem("Slow (50%)", "Half speed")
-	mSpeedMedium := mSpeed.AddSubMenuItem("Medium (75%)", "Medium speed")
-	mSpeedNormal := mSpeed.AddSubMenuItem("Normal (100%)", "Default speed")
-	mSpeedNormal.Check()
-	mSpeedFast := mSpeed.AddSubMenuItem("Fast (150%)", "Faster speed")
+	// Speed submenu, one entry per acceleration profile
+	mSpeed := systray.AddMenuItem("Speed: "+config.Acceleration.Profile, "Adjust mouse speed")
+	var mProfiles []*systray.MenuItem
+	for _, p := range config.Acceleration.Profiles {
+		item := mSpeed.AddSubMenuItem(p.Name, fmt.Sprintf("%s acceleration", p.Kind))
+		if p.Name == config.Acceleration.Profile {
+			item.Check()
+		}
+		mProfiles = append(mProfiles, item)
+	}
 
 	mRunOnLogin := systray.AddMenuItem("Run on Login", "Start MouseKeys when you log in")
 	if autostart.IsEnabled() {
@@ -372,39 +801,24 @@ func onReady() {
 	}()
 
 	// Speed selection handlers
-	uncheckAllSpeeds := func() {
-		mSpeedSlow.Uncheck()
-		mSpeedMedium.Uncheck()
-		mSpeedNormal.Uncheck()
-		mSpeedFast.Uncheck()
-	}
-
-	go func() {
-		for {
-			select {
-			case <-mSpeedSlow.ClickedCh:
-				speedMultiplier = 0.5
-				uncheckAllSpeeds()
-				mSpeedSlow.Check()
-				mSpeed.SetTitle("Speed: Slow")
-			case <-mSpeedMedium.ClickedCh:
-				speedMultiplier = 0.75
-				uncheckAllSpeeds()
-				mSpeedMedium.Check()
-				mSpeed.SetTitle("Speed: Medium")
-			case <-mSpeedNormal.ClickedCh:
-				speedMultiplier = 1.0
-				uncheckAllSpeeds()
-				mSpeedNormal.Check()
-				mSpeed.SetTitle("Speed: Normal")
-			case <-mSpeedFast.ClickedCh:
-				speedMultiplier = 1.5
-				uncheckAllSpeeds()
-				mSpeedFast.Check()
-				mSpeed.SetTitle("Speed: Fast")
+	for i, item := range mProfiles {
+		go func() {
+			for range item.ClickedCh {
+				name := config.Acceleration.Profiles[i].Name
+				profile, err := config.Acceleration.profile(name)
+				if err != nil {
+					fmt.Printf("Failed to switch speed: %v\n", err)
+					continue
+				}
+				mc.SetProfile(profile)
+				for _, other := range mProfiles {
+					other.Uncheck()
+				}
+				item.Check()
+				mSpeed.SetTitle("Speed: " + name)
 			}
-		}
-	}()
+		}()
+	}
 
 	go func() {
 		for {
@@ -429,16 +843,100 @@ func onExit() {
 	if hook != nil {
 		hook.Stop()
 	}
+	if closer, ok := mc.pointer.(io.Closer); ok {
+		closer.Close()
+	}
 }
 
 func main() {
+	configPath := flag.String("config", defaultConfigPath(), "path to the JSON config file")
+	var devices stringList
+	flag.Var(&devices, "device", "keyboard to use, by name, vendor:product or /dev/input path (repeatable, Linux only)")
+	keyboardBackend := flag.String("keyboard-backend", "", "keyboard hook to use instead of detecting one (evdev or x11 on Linux)")
+	pointerBackend := flag.String("pointer-backend", "", "pointer backend to use instead of detecting one (uinput, xtest or robotgo on Linux)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [list-devices | record-input FILE | replay-input FILE]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var err error
+	config, err = loadConfig(*configPath)
+	if err != nil {
+		fmt.Printf("Failed to load config: %v\n", err)
+		return
+	}
+	if len(devices) > 0 {
+		config.Devices = devices
+	}
+
+	var recordPath string
+	switch flag.Arg(0) {
+	case "":
+	case "record-input":
+		// Runs normally while saving the raw keyboard input for a bug report
+		recordPath = flag.Arg(1)
+		if recordPath == "" {
+			flag.Usage()
+			os.Exit(2)
+		}
+	case "list-devices":
+		if err := listInputDevices(os.Stdout); err != nil {
+			fmt.Printf("Failed to list devices: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "replay-input":
+		// Prints what a recorded session does to the pointer, without moving it
+		if flag.Arg(1) == "" {
+			flag.Usage()
+			os.Exit(2)
+		}
+		if err := replayInputFile(flag.Arg(1), os.Stdout); err != nil {
+			fmt.Printf("Failed to replay input: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
 	fmt.Println("MouseKeys - Caps Lock to toggle")
-	fmt.Println("WASD/QEZX=move, Space=click, Ctrl=right, Shift=middle, R/F=scroll")
+	fmt.Println("WASD/QEZX=move, Space=click, Ctrl=right, Shift=middle, R/F/T/G=scroll, C/V=back/forward, Tab/1=slow/fast, B=bisect")
 
-	mc = NewMouseController()
-	hook = NewKeyboardHook()
+	pointer, err := chooseBackend("pointer backend", pointerCandidates(), *pointerBackend)
+	if err != nil {
+		fmt.Printf("Failed to set up pointer control: %v\n", err)
+		return
+	}
+	mc = NewMouseController(pointer)
+	hook, err = chooseBackend("keyboard hook", keyboardHookCandidates(), *keyboardBackend)
+	if err != nil {
+		fmt.Printf("Failed to set up keyboard input: %v\n", err)
+		return
+	}
 	autostart = NewAutostart()
 
+	if recordPath != "" {
+		recorder, ok := hook.(InputRecorder)
+		if !ok {
+			fmt.Println("Recording input needs the Linux evdev keyboard hook")
+			return
+		}
+		f, err := os.Create(recordPath)
+		if err != nil {
+			fmt.Printf("Failed to create recording: %v\n", err)
+			return
+		}
+		if err := recorder.RecordInput(f); err != nil {
+			f.Close()
+			fmt.Printf("Failed to start recording: %v\n", err)
+			return
+		}
+		fmt.Printf("Recording keyboard input to %s\n", recordPath)
+	}
+
 	go mc.RunLoop()
 
 	// Start keyboard hook and process events
@@ -454,5 +952,11 @@ func main() {
 		}
 	}()
 
+	if config.Gamepad.Enabled {
+		if err := startGamepad(config.Gamepad, mc, processKeyEvent); err != nil {
+			fmt.Printf("Failed to start gamepad input: %v\n", err)
+		}
+	}
+
 	systray.Run(onReady, onExit)
 }
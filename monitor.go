@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// Speeds are meant for a 1080 pixel tall, 96 DPI screen; speed scaling
+// adjusts them for the monitor under the pointer
+const (
+	referenceHeight = 1080
+	referenceDPI    = 96
+
+	monitorRefresh = 2 * time.Second // How often the monitor layout is read again
+)
+
+// listMonitors returns the monitors of a pointer backend, or its whole
+// screen as one monitor of unknown size
+func listMonitors(p PointerBackend) []Monitor {
+	if lister, ok := p.(MonitorLister); ok {
+		if monitors := lister.Monitors(); len(monitors) > 0 {
+			return monitors
+		}
+	}
+	width, height := p.ScreenSize()
+	return []Monitor{{Width: width, Height: height}}
+}
+
+// monitorAt returns the monitor holding a point, or the first one when the
+// point is on none of them
+func monitorAt(monitors []Monitor, x, y int) Monitor {
+	for _, m := range monitors {
+		if x >= m.X && x < m.X+m.Width && y >= m.Y && y < m.Y+m.Height {
+			return m
+		}
+	}
+	return monitors[0]
+}
+
+// speedScale returns the factor speeds are multiplied by on a monitor:
+// by its height for "resolution", by its pixel density for "dpi"
+func speedScale(m Monitor, mode string) float64 {
+	switch mode {
+	case "resolution":
+		if m.Height > 0 {
+			return float64(m.Height) / referenceHeight
+		}
+	case "dpi":
+		// The diagonal holds up when the monitor is rotated
+		if m.WidthMM > 0 && m.HeightMM > 0 {
+			dpi := math.Hypot(float64(m.Width), float64(m.Height)) / (math.Hypot(float64(m.WidthMM), float64(m.HeightMM)) / 25.4)
+			return dpi / referenceDPI
+		}
+	}
+	return 1
+}
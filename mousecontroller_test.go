@@ -1,6 +1,12 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 )
@@ -20,8 +26,14 @@ const (
 	KeySpace int64 = 49
 )
 
+// newTestController returns a controller driving an in-memory pointer
+func newTestController() (*MouseController, *recordingPointer) {
+	pointer := newRecordingPointer(1920, 1080)
+	return NewMouseController(pointer), pointer
+}
+
 func TestNewMouseController(t *testing.T) {
-	mc := NewMouseController()
+	mc := NewMouseController(newRecordingPointer(1920, 1080))
 	if mc == nil {
 		t.Fatal("NewMouseController returned nil")
 	}
@@ -31,7 +43,7 @@ func TestNewMouseController(t *testing.T) {
 }
 
 func TestToggle(t *testing.T) {
-	mc := NewMouseController()
+	mc, _ := newTestController()
 
 	// Initially inactive
 	if mc.IsActive() {
@@ -52,7 +64,7 @@ func TestToggle(t *testing.T) {
 }
 
 func TestToggleResetsKeyState(t *testing.T) {
-	mc := NewMouseController()
+	mc, _ := newTestController()
 	mc.Toggle() // Activate
 
 	// Set some key states
@@ -64,14 +76,14 @@ func TestToggleResetsKeyState(t *testing.T) {
 
 	// Verify keys are reset
 	mc.mu.Lock()
-	if mc.keyW || mc.keyA || mc.keyS || mc.keyD {
+	if len(mc.moveOrder) > 0 {
 		t.Error("Toggle off should reset all key states")
 	}
 	mc.mu.Unlock()
 }
 
 func TestHandleKeyDownWhenInactive(t *testing.T) {
-	mc := NewMouseController()
+	mc, _ := newTestController()
 
 	// Should return false when inactive
 	if mc.HandleKeyDown(KeyW) {
@@ -80,7 +92,7 @@ func TestHandleKeyDownWhenInactive(t *testing.T) {
 }
 
 func TestHandleKeyDownWhenActive(t *testing.T) {
-	mc := NewMouseController()
+	mc, _ := newTestController()
 	mc.Toggle() // Activate
 
 	tests := []struct {
@@ -108,7 +120,7 @@ func TestHandleKeyDownWhenActive(t *testing.T) {
 }
 
 func TestHandleKeyUpWhenInactive(t *testing.T) {
-	mc := NewMouseController()
+	mc, _ := newTestController()
 
 	if mc.HandleKeyUp(KeyW) {
 		t.Error("HandleKeyUp should return false when inactive")
@@ -116,7 +128,7 @@ func TestHandleKeyUpWhenInactive(t *testing.T) {
 }
 
 func TestHandleKeyUpWhenActive(t *testing.T) {
-	mc := NewMouseController()
+	mc, _ := newTestController()
 	mc.Toggle() // Activate
 
 	// First press then release
@@ -127,19 +139,19 @@ func TestHandleKeyUpWhenActive(t *testing.T) {
 }
 
 func TestGetMovementWhenInactive(t *testing.T) {
-	mc := NewMouseController()
+	mc, _ := newTestController()
 
-	dx, dy := mc.GetMovement()
+	dx, dy := mc.GetMovement(time.Second)
 	if dx != 0 || dy != 0 {
 		t.Errorf("GetMovement should return (0,0) when inactive, got (%f,%f)", dx, dy)
 	}
 }
 
 func TestGetMovementNoKeys(t *testing.T) {
-	mc := NewMouseController()
+	mc, _ := newTestController()
 	mc.Toggle() // Activate
 
-	dx, dy := mc.GetMovement()
+	dx, dy := mc.GetMovement(time.Second)
 	if dx != 0 || dy != 0 {
 		t.Errorf("GetMovement should return (0,0) with no keys pressed, got (%f,%f)", dx, dy)
 	}
@@ -160,11 +172,11 @@ func TestGetMovementCardinalDirections(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mc := NewMouseController()
+			mc, _ := newTestController()
 			mc.Toggle()
 			mc.HandleKeyDown(tt.keycode)
 
-			dx, dy := mc.GetMovement()
+			dx, dy := mc.GetMovement(time.Second)
 
 			// At base speed, check direction
 			if tt.expectDx < 0 && dx >= 0 {
@@ -204,11 +216,11 @@ func TestGetMovementDiagonalDirections(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mc := NewMouseController()
+			mc, _ := newTestController()
 			mc.Toggle()
 			mc.HandleKeyDown(tt.keycode)
 
-			dx, dy := mc.GetMovement()
+			dx, dy := mc.GetMovement(time.Second)
 
 			// Check directions (diagonal keys produce ~0.707 factor)
 			if tt.expectDx < 0 && dx >= 0 {
@@ -228,18 +240,18 @@ func TestGetMovementDiagonalDirections(t *testing.T) {
 }
 
 func TestGetMovementDiagonalNormalization(t *testing.T) {
-	mc := NewMouseController()
+	mc, _ := newTestController()
 	mc.Toggle()
 
 	// Press W and D together (diagonal via cardinal keys)
 	mc.HandleKeyDown(KeyW)
 	mc.HandleKeyDown(KeyD)
 
-	dx, dy := mc.GetMovement()
+	dx, dy := mc.GetMovement(time.Second)
 
-	// Combined cardinal should be normalized (0.707 factor)
-	// At base speed = 1.0, diagonal should be ~0.707 each direction
-	expectedMagnitude := 0.707 * baseSpeed
+	// Combined cardinal should be normalized to unit length
+	// At base speed, diagonal should be ~0.707 of it in each direction
+	expectedMagnitude := math.Sqrt2 / 2 * slowSpeed
 	tolerance := 0.01
 
 	if dx < expectedMagnitude-tolerance || dx > expectedMagnitude+tolerance {
@@ -250,17 +262,138 @@ func TestGetMovementDiagonalNormalization(t *testing.T) {
 	}
 }
 
+func TestSOCDPolicies(t *testing.T) {
+	saved := config.SOCD
+	defer func() { config.SOCD = saved }()
+
+	tests := []struct {
+		policy string
+		keys   []Key
+		wantX  float64
+		wantY  float64
+	}{
+		// Opposite keys cancel out unless the config picks another policy
+		{DefaultConfig().SOCD, []Key{KeyMoveLeft, KeyMoveRight}, 0, 0},
+		{"neutral", []Key{KeyMoveLeft, KeyMoveRight}, 0, 0},
+		{"last", []Key{KeyMoveLeft, KeyMoveRight}, 1, 0},
+		{"first", []Key{KeyMoveLeft, KeyMoveRight}, -1, 0},
+		// Only the vertical axis is contested, left stays
+		{"neutral", []Key{KeyDiagUpLeft, KeyMoveDown}, -1, 0},
+		{"last", []Key{KeyDiagUpLeft, KeyMoveDown}, -0.577, 0.816},
+		// Not a conflict: halfway between up and up-left
+		{"neutral", []Key{KeyMoveUp, KeyDiagUpLeft}, -0.383, -0.924},
+	}
+
+	for _, tt := range tests {
+		config.SOCD = tt.policy
+		mc, _ := newTestController()
+		mc.Toggle()
+		for _, key := range tt.keys {
+			mc.HandleKeyDownByKey(key)
+		}
+
+		mc.mu.Lock()
+		x, y := mc.moveInput()
+		mc.mu.Unlock()
+		if math.Abs(x-tt.wantX) > 0.001 || math.Abs(y-tt.wantY) > 0.001 {
+			t.Errorf("%s with %v: expected direction (%.3f,%.3f), got (%.3f,%.3f)", tt.policy, tt.keys, tt.wantX, tt.wantY, x, y)
+		}
+	}
+}
+
+func TestConfigDirections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"directions": {"j": {"angle": 15}, "K": {"x": 3, "y": 4}}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	defer func(saved *Config) { config = saved }(config)
+	config = cfg
+
+	mc, _ := newTestController()
+	mc.Toggle()
+	mc.HandleKeyDownByKey(boundKey("j"))
+	dx, dy := mc.GetMovement(time.Second)
+	if want := slowSpeed * math.Sin(math.Pi/12); math.Abs(dx-want) > 1e-6 || dy >= 0 {
+		t.Errorf("Expected j to move 15° right of up, got (%f,%f)", dx, dy)
+	}
+
+	x, y, ok := moveKeyDirection(boundKey("k"))
+	if !ok || math.Abs(x-0.6) > 1e-9 || math.Abs(y-0.8) > 1e-9 {
+		t.Errorf("Expected k to move along (0.6,0.8), got (%f,%f)", x, y)
+	}
+}
+
+func TestConfigEmptyProfilesUseDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"acceleration": {"profiles": []}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if len(cfg.Acceleration.Profiles) != len(defaultProfiles()) || cfg.Acceleration.Profile != "Normal" {
+		t.Errorf("Expected an empty profile list to fall back to the presets, got %d profiles and %q",
+			len(cfg.Acceleration.Profiles), cfg.Acceleration.Profile)
+	}
+}
+
+func TestConfigRejectsNegativeScroll(t *testing.T) {
+	for _, data := range []string{`{"scroll": {"speed": -25}}`, `{"scroll": {"step": -1}}`, `{"scroll": {"rampTime": -5}}`} {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig(path); err == nil {
+			t.Errorf("Expected %s to be rejected", data)
+		}
+	}
+}
+
+func TestConfigRejectsConflictingKeys(t *testing.T) {
+	load := func(data string) error {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadConfig(path)
+		return err
+	}
+
+	for _, data := range []string{
+		`{"directions": {"w": {"angle": 30}}}`,
+		`{"buttons": {"r": 10}}`,
+		`{"turbo": {"key": "b"}}`,
+		`{"buttons": {"1": 10}}`,
+		`{"directions": {"K": {"angle": 30}}, "buttons": {"k": 10}}`,
+	} {
+		if err := load(data); err == nil {
+			t.Errorf("Expected %s to be rejected", data)
+		}
+	}
+
+	// A feature key that's switched off frees its key
+	if err := load(`{"bisect": {"key": ""}, "buttons": {"b": 10}}`); err != nil {
+		t.Errorf("Expected b to be free once bisection is off: %v", err)
+	}
+}
+
 func TestAcceleration(t *testing.T) {
-	mc := NewMouseController()
+	mc, _ := newTestController()
 	mc.Toggle()
 	mc.HandleKeyDown(KeyD) // Move right
 
 	// First call - should be at base speed
-	dx1, _ := mc.GetMovement()
+	dx1, _ := mc.GetMovement(time.Second)
 
 	// Wait and check acceleration
 	time.Sleep(200 * time.Millisecond)
-	dx2, _ := mc.GetMovement()
+	dx2, _ := mc.GetMovement(time.Second)
 
 	if dx2 <= dx1 {
 		t.Errorf("Speed should increase over time: initial=%f, after 200ms=%f", dx1, dx2)
@@ -268,21 +401,21 @@ func TestAcceleration(t *testing.T) {
 }
 
 func TestAccelerationResetOnDirectionChange(t *testing.T) {
-	mc := NewMouseController()
+	mc, _ := newTestController()
 	mc.Toggle()
 
 	// Move right for a bit
 	mc.HandleKeyDown(KeyD)
-	mc.GetMovement()
+	mc.GetMovement(time.Second)
 	time.Sleep(100 * time.Millisecond)
-	dxBefore, _ := mc.GetMovement()
+	dxBefore, _ := mc.GetMovement(time.Second)
 
 	// Change direction
 	mc.HandleKeyUp(KeyD)
 	mc.HandleKeyDown(KeyA)
 
 	// Speed should reset to base
-	dxAfter, _ := mc.GetMovement()
+	dxAfter, _ := mc.GetMovement(time.Second)
 
 	// dxAfter should be negative (left) and close to base speed
 	if dxAfter >= 0 {
@@ -294,7 +427,7 @@ func TestAccelerationResetOnDirectionChange(t *testing.T) {
 }
 
 func TestSpaceKeyLeftClick(t *testing.T) {
-	mc := NewMouseController()
+	mc, pointer := newTestController()
 	mc.Toggle()
 
 	// Press space
@@ -318,10 +451,329 @@ func TestSpaceKeyLeftClick(t *testing.T) {
 	if leftDown {
 		t.Error("Releasing space should set leftDown to false")
 	}
+
+	assertOps(t, pointer, "press left", "release left")
+}
+
+func TestButtonSequence(t *testing.T) {
+	mc, pointer := newTestController()
+	mc.Toggle()
+
+	mc.HandleKeyDownByKey(KeyRightClick)
+	mc.HandleKeyDownByKey(KeyMiddleClick)
+
+	// A drag still in progress is released when mouse mode turns off
+	mc.HandleKeyDownByKey(KeyLeftClick)
+	mc.Toggle()
+
+	assertOps(t, pointer, "click right", "click middle", "press left", "release left")
+}
+
+func TestExtraButtonsHoldUntilReleased(t *testing.T) {
+	mc, pointer := newTestController()
+	mc.Toggle()
+
+	mc.HandleKeyDownByKey(KeyBack)
+	mc.HandleKeyDownByKey(KeyBack) // Autorepeat
+	mc.HandleKeyUpByKey(KeyBack)
+	mc.HandleKeyDownByKey(KeyForward)
+	mc.HandleKeyUpByKey(KeyForward)
+
+	// Still held when mouse mode is turned off
+	mc.HandleKeyDownByKey(ButtonKey(11))
+	mc.Toggle()
+
+	assertOps(t, pointer, "press back", "release back", "press forward", "release forward",
+		"press button11", "release button11")
+}
+
+func TestScrollKeyTapScrollsOneStep(t *testing.T) {
+	mc, pointer := newTestController()
+	now := time.Now()
+	mc.now = func() time.Time { return now }
+	mc.Toggle()
+
+	mc.HandleKeyDownByKey(KeyScrollUp)
+	mc.HandleKeyUpByKey(KeyScrollUp)
+	mc.tick()
+	mc.HandleKeyDownByKey(KeyScrollLeft)
+	mc.HandleKeyUpByKey(KeyScrollLeft)
+	mc.tick()
+
+	assertOps(t, pointer, "scroll 0,1", "scroll -1,0")
+}
+
+func TestScrollKeyHeldAccelerates(t *testing.T) {
+	mc, _ := newTestController()
+	now := time.Now()
+	mc.now = func() time.Time { return now }
+	mc.Toggle()
+
+	mc.HandleKeyDownByKey(KeyScrollDown)
+	scrollFor := func(d time.Duration) (total int) {
+		tick := config.tickInterval()
+		for end := now.Add(d); now.Before(end); now = now.Add(tick) {
+			_, dy := mc.GetScroll(tick)
+			total += dy
+		}
+		return total
+	}
+
+	// The first step, then the ramp from InitialSpeed to Speed
+	first := scrollFor(time.Second)
+	if first > -10 || first < -14 {
+		t.Errorf("Expected about 12 notches down in the first second, got %d", -first)
+	}
+	if second := scrollFor(time.Second); second >= first || second < -27 {
+		t.Errorf("Expected about %v notches down once at full speed, got %d", config.Scroll.Speed, -second)
+	}
+}
+
+func TestTickClampsToScreen(t *testing.T) {
+	mc, pointer := newTestController()
+	now := time.Now()
+	mc.now = func() time.Time { return now }
+	mc.Toggle()
+	pointer.Move(1, 500)
+
+	mc.HandleKeyDownByKey(KeyMoveLeft)
+	mc.tick()
+	now = now.Add(config.tickInterval())
+	mc.tick()
+
+	assertOps(t, pointer, "move 1,500", "move 0,500", "move 0,500")
+}
+
+func TestTickCarriesSubPixelMotion(t *testing.T) {
+	mc, pointer := newTestController()
+	now := time.Now()
+	mc.now = func() time.Time { return now }
+	mc.Toggle()
+	pointer.Move(500, 500)
+
+	// Well under a pixel per tick on each axis, which used to truncate to nothing
+	mc.SetProfile(constantProfile(slowSpeed / 2))
+	mc.HandleKeyDownByKey(KeyDiagDownLeft)
+	dx, dy := mc.GetMovement(config.tickInterval())
+	for i := 0; i < 8; i++ {
+		mc.tick()
+		now = now.Add(config.tickInterval())
+	}
+
+	x, y := pointer.Location()
+	wantX, wantY := 500+int(8*dx), 500+int(8*dy)
+	if x != wantX || y != wantY {
+		t.Errorf("Expected pointer at %d,%d after 8 ticks, got %d,%d", wantX, wantY, x, y)
+	}
+}
+
+func TestMovementIndependentOfTickRate(t *testing.T) {
+	moveFor := func(ticks int, interval time.Duration) int {
+		mc, pointer := newTestController()
+		now := time.Now()
+		mc.now = func() time.Time { return now }
+		mc.Toggle()
+		mc.SetProfile(constantProfile(slowSpeed))
+		pointer.Move(500, 500)
+
+		mc.HandleKeyDownByKey(KeyMoveRight)
+		mc.tick()
+		for i := 0; i < ticks; i++ {
+			now = now.Add(interval)
+			mc.tick()
+		}
+		x, _ := pointer.Location()
+		return x - 500
+	}
+
+	// 80ms of fast ticks, and of a ticker that keeps stalling
+	fast, stalled := moveFor(10, 8*time.Millisecond), moveFor(2, 40*time.Millisecond)
+	if fast != stalled {
+		t.Errorf("Expected the same distance at any tick rate, got %d and %d", fast, stalled)
+	}
+}
+
+func TestInertiaGlidesAndBrakes(t *testing.T) {
+	config.Inertia.Enabled = true
+	defer func() { config.Inertia.Enabled = false }()
+
+	mc, _ := newTestController()
+	mc.Toggle()
+	mc.SetProfile(constantProfile(1000))
+	tick := config.tickInterval()
+
+	mc.HandleKeyDownByKey(KeyMoveRight)
+	held, _ := mc.GetMovement(tick)
+	mc.HandleKeyUpByKey(KeyMoveRight)
+
+	first, _ := mc.GetMovement(tick)
+	second, _ := mc.GetMovement(tick)
+	if first <= 0 || first >= held || second >= first {
+		t.Errorf("Expected a slowing glide after %f, got %f then %f", held, first, second)
+	}
+
+	// Tapping the opposite direction stops the glide without moving back
+	mc.HandleKeyDownByKey(KeyMoveLeft)
+	if dx, _ := mc.GetMovement(tick); dx != 0 {
+		t.Errorf("Expected the brake to hold the pointer, got dx=%f", dx)
+	}
+	mc.HandleKeyUpByKey(KeyMoveLeft)
+	if dx, _ := mc.GetMovement(tick); dx != 0 {
+		t.Errorf("Expected no glide after braking, got dx=%f", dx)
+	}
+}
+
+func TestSpeedKeysScaleMidMotion(t *testing.T) {
+	mc, _ := newTestController()
+	now := time.Now()
+	mc.now = func() time.Time { return now }
+	mc.Toggle()
+
+	mc.HandleKeyDownByKey(KeyMoveRight)
+	mc.GetMovement(time.Second)
+	now = now.Add(time.Second)
+	full, _ := mc.GetMovement(time.Second)
+
+	// Still fully accelerated, just scaled
+	mc.HandleKeyDownByKey(KeyPrecision)
+	precise, _ := mc.GetMovement(time.Second)
+	mc.HandleKeyDownByKey(KeyTurbo)
+	both, _ := mc.GetMovement(time.Second)
+	mc.HandleKeyUpByKey(KeyPrecision)
+	turbo, _ := mc.GetMovement(time.Second)
+
+	scale := config.Precision.Scale
+	if math.Abs(precise-full*scale) > 1e-9 {
+		t.Errorf("Expected precision speed %f, got %f", full*scale, precise)
+	}
+	if scale *= config.Turbo.Scale; math.Abs(both-full*scale) > 1e-9 {
+		t.Errorf("Expected precision and turbo to stack to %f, got %f", full*scale, both)
+	}
+	if math.Abs(turbo-full*config.Turbo.Scale) > 1e-9 {
+		t.Errorf("Expected turbo speed %f, got %f", full*config.Turbo.Scale, turbo)
+	}
+}
+
+func TestTapNudgesExactly(t *testing.T) {
+	config.Nudge.Distance = 10
+	defer func() { config.Nudge.Distance = 0 }()
+
+	mc, pointer := newTestController()
+	now := time.Now()
+	mc.now = func() time.Time { return now }
+	mc.Toggle()
+	pointer.Move(500, 500)
+	hold := func(key Key, d time.Duration) {
+		mc.HandleKeyDownByKey(key)
+		for end := now.Add(d); now.Before(end); now = now.Add(config.tickInterval()) {
+			mc.tick()
+		}
+		mc.HandleKeyUpByKey(key)
+		mc.tick()
+	}
+
+	// However many ticks a tap spans, it moves the same distance
+	hold(KeyMoveRight, 40*time.Millisecond)
+	hold(KeyMoveRight, 120*time.Millisecond)
+	hold(KeyDiagUpLeft, 50*time.Millisecond)
+	if x, y := pointer.Location(); x != 513 || y != 493 {
+		t.Errorf("Expected taps to nudge the pointer to 513,493, got %d,%d", x, y)
+	}
+
+	// Holding past the threshold moves continuously
+	hold(KeyMoveDown, 400*time.Millisecond)
+	if _, y := pointer.Location(); y <= 503 {
+		t.Errorf("Expected a hold to move further than a nudge, got to y=%d", y)
+	}
+}
+
+func TestTapTimedByEventTimestamps(t *testing.T) {
+	config.Nudge.Distance = 10
+	defer func() { config.Nudge.Distance = 0 }()
+
+	mc, pointer := newTestController()
+	pressed := time.Now()
+	now := pressed
+	mc.now = func() time.Time { return now }
+	mc.Toggle()
+	pointer.Move(500, 500)
+
+	// The release is handled long after the key came back up
+	mc.HandleKeyEvent(KeyEvent{Keycode: KeyMoveRight, EventType: KeyDown, Time: pressed})
+	now = pressed.Add(400 * time.Millisecond)
+	mc.HandleKeyEvent(KeyEvent{Keycode: KeyMoveRight, EventType: KeyUp, Time: pressed.Add(50 * time.Millisecond)})
+	mc.tick()
+
+	if x, _ := pointer.Location(); x != 510 {
+		t.Errorf("Expected a 50ms tap handled late to nudge to x=510, got %d", x)
+	}
+}
+
+func TestBisectionHalvesRegion(t *testing.T) {
+	mc, pointer := newTestController()
+	now := time.Now()
+	mc.now = func() time.Time { return now }
+	mc.Toggle()
+	press := func(key Key) {
+		mc.HandleKeyDownByKey(key)
+		now = now.Add(config.tickInterval())
+		mc.tick()
+		mc.HandleKeyUpByKey(key)
+	}
+
+	press(KeyBisect)
+	press(KeyMoveRight)
+	press(KeyMoveDown)
+	press(KeyDiagUpLeft)
+	press(KeyBisectUndo)
+	press(KeyBisect)
+	press(KeyMoveLeft)
+
+	// After leaving the mode, A moves left again instead of cutting
+	assertOps(t, pointer, "move 960,540", "move 1440,540", "move 1440,810",
+		"move 1200,675", "move 1440,810", "move 1438,810")
+}
+
+func TestWarpToClampsToScreen(t *testing.T) {
+	mc, pointer := newTestController()
+
+	mc.WarpTo(960, 540)
+	mc.WarpTo(5000, -20)
+
+	assertOps(t, pointer, "move 960,540", "move 1919,0")
+}
+
+// relativeRecordingPointer is a recordingPointer that only moves by offsets
+type relativeRecordingPointer struct {
+	*recordingPointer
+}
+
+func (p relativeRecordingPointer) MoveRelative(dx, dy int) {
+	p.record("move by %d,%d", dx, dy)
+}
+
+func TestTickMovesRelativePointer(t *testing.T) {
+	pointer := relativeRecordingPointer{newRecordingPointer(1920, 1080)}
+	mc := NewMouseController(pointer)
+	mc.Toggle()
+
+	// No clamping: the system keeps a relative pointer on screen
+	mc.HandleKeyDownByKey(KeyMoveLeft)
+	mc.tick()
+
+	assertOps(t, pointer.recordingPointer, fmt.Sprintf("move by %d,0", -int(slowSpeed*config.tickInterval().Seconds())))
+}
+
+// assertOps checks the exact calls made on a recording pointer
+func assertOps(t *testing.T, pointer *recordingPointer, want ...string) {
+	t.Helper()
+	if got := pointer.Ops(); !slices.Equal(got, want) {
+		t.Errorf("pointer calls = %q, want %q", got, want)
+	}
 }
 
 func TestUnknownKeyReturnsTrue(t *testing.T) {
-	mc := NewMouseController()
+	mc, _ := newTestController()
 	mc.Toggle()
 
 	// Unknown key should return false (not handled)
@@ -332,7 +784,7 @@ func TestUnknownKeyReturnsTrue(t *testing.T) {
 }
 
 func TestConcurrentAccess(t *testing.T) {
-	mc := NewMouseController()
+	mc, _ := newTestController()
 	mc.Toggle()
 
 	done := make(chan bool)
@@ -349,7 +801,7 @@ func TestConcurrentAccess(t *testing.T) {
 	// Goroutine getting movement
 	go func() {
 		for i := 0; i < 100; i++ {
-			mc.GetMovement()
+			mc.GetMovement(time.Second)
 		}
 		done <- true
 	}()
@@ -370,3 +822,180 @@ func TestConcurrentAccess(t *testing.T) {
 
 	// If we get here without deadlock or panic, test passes
 }
+
+func TestStickResponse(t *testing.T) {
+	if x, y := stickResponse(0.1, 0.05, 0.15, 2); x != 0 || y != 0 {
+		t.Errorf("Stick inside deadzone should give (0,0), got (%f,%f)", x, y)
+	}
+
+	x, y := stickResponse(1, 0, 0.15, 2)
+	if math.Abs(x-1) > 1e-9 || y != 0 {
+		t.Errorf("Full deflection should give (1,0), got (%f,%f)", x, y)
+	}
+
+	// Halfway between deadzone and full deflection, squared by the curve
+	x, _ = stickResponse(0.575, 0, 0.15, 2)
+	if math.Abs(x-0.25) > 1e-9 {
+		t.Errorf("Expected 0.25 with a quadratic curve, got %f", x)
+	}
+}
+
+func TestAnalogMovement(t *testing.T) {
+	mc, _ := newTestController()
+	mc.Toggle()
+	mc.SetAnalogMove(0.5, -1)
+
+	dx, dy := mc.GetMovement(time.Second)
+	if dx != 0.5*normalSpeed || dy != -normalSpeed {
+		t.Errorf("Expected analog movement (%f,%f), got (%f,%f)", 0.5*normalSpeed, -normalSpeed, dx, dy)
+	}
+}
+
+func TestAnalogScrollCarriesFractions(t *testing.T) {
+	mc, _ := newTestController()
+	mc.Toggle()
+	mc.SetAnalogScroll(0, 1)
+
+	// At full deflection a step is due every 1/analogScrollRate seconds
+	total := 0
+	tick := config.tickInterval()
+	ticks := int(time.Second / tick)
+	for i := 0; i < ticks; i++ {
+		_, dy := mc.GetScroll(tick)
+		total += dy
+	}
+
+	expected := int(analogScrollRate * float64(ticks) * tick.Seconds())
+	if total != expected {
+		t.Errorf("Expected %d scroll steps over %d ticks, got %d", expected, ticks, total)
+	}
+}
+
+// monitorRecordingPointer is a recordingPointer spanning several monitors
+type monitorRecordingPointer struct {
+	*recordingPointer
+	monitors []Monitor
+}
+
+func (p monitorRecordingPointer) Monitors() []Monitor {
+	return p.monitors
+}
+
+func TestSpeedScalesWithMonitor(t *testing.T) {
+	config.SpeedScale = "resolution"
+	defer func() { config.SpeedScale = "none" }()
+
+	// A 1080p monitor next to a 4K one
+	pointer := monitorRecordingPointer{newRecordingPointer(3840, 2160), []Monitor{
+		{Width: 1920, Height: 1080, WidthMM: 527, HeightMM: 296},
+		{X: 1920, Width: 1920 * 2, Height: 2160, WidthMM: 597, HeightMM: 336},
+	}}
+	mc := NewMouseController(pointer)
+	now := time.Now()
+	mc.now = func() time.Time { return now }
+	mc.Toggle()
+	mc.SetProfile(constantProfile(1000))
+
+	pointer.Move(100, 500)
+	mc.HandleKeyDownByKey(KeyMoveRight)
+	mc.tick()
+	pointer.Move(2000, 500)
+	now = now.Add(config.tickInterval())
+	mc.tick()
+
+	assertOps(t, pointer.recordingPointer, "move 100,500", "move 116,500", "move 2000,500", "move 2032,500")
+
+	if dpi := speedScale(pointer.monitors[1], "dpi"); math.Abs(dpi-1.7) > 0.05 {
+		t.Errorf("Expected a 27\" 4K monitor to scale by about 1.7, got %f", dpi)
+	}
+}
+
+// locatingPointer counts the position queries, which cost a round-trip on X11
+type locatingPointer struct {
+	*recordingPointer
+	queries int
+}
+
+func (p *locatingPointer) Location() (int, int) {
+	p.queries++
+	return p.recordingPointer.Location()
+}
+
+func TestSpeedScaleSkipsIdleTicks(t *testing.T) {
+	config.SpeedScale = "resolution"
+	defer func() { config.SpeedScale = "none" }()
+
+	pointer := &locatingPointer{recordingPointer: newRecordingPointer(1920, 1080)}
+	mc := NewMouseController(pointer)
+	mc.Toggle()
+	for range 10 {
+		mc.tick()
+	}
+	if pointer.queries != 0 {
+		t.Errorf("Expected idle ticks not to query the pointer, got %d queries", pointer.queries)
+	}
+
+	mc.HandleKeyDownByKey(KeyMoveRight)
+	mc.tick()
+	if pointer.queries != 1 {
+		t.Errorf("Expected a moving tick to query the pointer once, got %d queries", pointer.queries)
+	}
+}
+
+func TestAccelerationProfiles(t *testing.T) {
+	tests := []struct {
+		cfg  ProfileConfig
+		held float64
+		want float64
+	}{
+		{ProfileConfig{Kind: "constant", MaxSpeed: 500}, 0, 500},
+		{ProfileConfig{Kind: "linear", InitialSpeed: 100, MaxSpeed: 900, RampTime: 400}, 0.1, 300},
+		{ProfileConfig{Kind: "linear", InitialSpeed: 100, MaxSpeed: 900, RampTime: 400}, 2, 900},
+		{ProfileConfig{Kind: "exponential", InitialSpeed: 100, MaxSpeed: 900, RampTime: 400}, 0.2, 300},
+		{ProfileConfig{Kind: "bezier", InitialSpeed: 100, MaxSpeed: 900, RampTime: 400}, 0.2, 500},
+		{ProfileConfig{Kind: "bezier", InitialSpeed: 100, MaxSpeed: 900, RampTime: 400, Curve: []float64{0, 0, 1, 1}}, 0.1, 300},
+		{ProfileConfig{Kind: "steps", Steps: []SpeedStepConfig{{0, 100}, {150, 600}, {500, 1200}}}, 0.149, 100},
+		{ProfileConfig{Kind: "steps", Steps: []SpeedStepConfig{{0, 100}, {150, 600}, {500, 1200}}}, 0.2, 600},
+	}
+
+	for _, tt := range tests {
+		profile, err := newAccelerationProfile(tt.cfg)
+		if err != nil {
+			t.Fatalf("%s profile: %v", tt.cfg.Kind, err)
+		}
+		if got := profile.Speed(tt.held); math.Abs(got-tt.want) > 0.01 {
+			t.Errorf("%s profile after %vs: expected %v px/s, got %v", tt.cfg.Kind, tt.held, tt.want, got)
+		}
+	}
+
+	if _, err := newAccelerationProfile(ProfileConfig{Kind: "steps", Steps: []SpeedStepConfig{{100, 1}, {0, 2}}}); err == nil {
+		t.Error("Unsorted steps should be rejected")
+	}
+}
+
+func TestChooseBackendFallsBack(t *testing.T) {
+	open := func(name string, err error) func() (string, error) {
+		return func() (string, error) { return name, err }
+	}
+	candidates := []backendCandidate[string]{
+		{name: "broken", open: open("broken", errors.New("no device"))},
+		{name: "degraded", degraded: "only half works", open: open("degraded", nil)},
+		{name: "good", open: open("good", nil)},
+	}
+
+	if got, err := chooseBackend("backend", candidates, ""); err != nil || got != "good" {
+		t.Errorf("chooseBackend() = %q, %v, want good", got, err)
+	}
+	if got, err := chooseBackend("backend", candidates[:2], ""); err != nil || got != "degraded" {
+		t.Errorf("chooseBackend() without good = %q, %v, want degraded", got, err)
+	}
+	if got, err := chooseBackend("backend", candidates, "degraded"); err != nil || got != "degraded" {
+		t.Errorf("chooseBackend() forcing degraded = %q, %v, want degraded", got, err)
+	}
+	if _, err := chooseBackend("backend", candidates, "broken"); err == nil {
+		t.Error("forcing a broken backend should fail")
+	}
+	if _, err := chooseBackend("backend", candidates, "missing"); err == nil {
+		t.Error("forcing an unknown backend should fail")
+	}
+}
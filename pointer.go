@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MouseButton identifies a pointer button by its X11 number. 4 to 7 are
+// the scroll wheel there and never used as buttons.
+type MouseButton int
+
+const (
+	ButtonLeft    MouseButton = 1
+	ButtonMiddle  MouseButton = 2
+	ButtonRight   MouseButton = 3
+	ButtonBack    MouseButton = 8
+	ButtonForward MouseButton = 9
+
+	maxMouseButton = 12
+)
+
+// validButton reports whether n is a button number backends can press
+func validButton(n MouseButton) bool {
+	return n >= ButtonLeft && n <= ButtonRight || n >= ButtonBack && n <= maxMouseButton
+}
+
+func (b MouseButton) String() string {
+	switch b {
+	case ButtonLeft:
+		return "left"
+	case ButtonRight:
+		return "right"
+	case ButtonMiddle:
+		return "middle"
+	case ButtonBack:
+		return "back"
+	case ButtonForward:
+		return "forward"
+	default:
+		return fmt.Sprintf("button%d", int(b))
+	}
+}
+
+// PointerBackend is what MouseController drives: the pointer position,
+// its buttons and the scroll wheel
+type PointerBackend interface {
+	// Location returns the pointer position in screen pixels
+	Location() (x, y int)
+	// Move warps the pointer to a screen position
+	Move(x, y int)
+	// ScreenSize returns the size of the area the pointer can move in
+	ScreenSize() (width, height int)
+
+	Press(button MouseButton)
+	Release(button MouseButton)
+	Click(button MouseButton)
+
+	// Scroll turns the wheel by x, y notches; positive y scrolls up and
+	// positive x scrolls right
+	Scroll(x, y int)
+}
+
+// HighResScroller is implemented by backends that can scroll by fractions
+// of a notch, which makes continuous scrolling smooth
+type HighResScroller interface {
+	// ScrollHighRes scrolls like Scroll, but takes fractional notches
+	ScrollHighRes(x, y float64)
+}
+
+// RelativePointer is implemented by backends that move the pointer by an
+// offset rather than to a position, such as a virtual mouse device
+type RelativePointer interface {
+	MoveRelative(dx, dy int)
+}
+
+// MonitorLister is implemented by backends that know the monitor layout
+type MonitorLister interface {
+	Monitors() []Monitor
+}
+
+// Monitor is one screen of the desktop, in pointer coordinates
+type Monitor struct {
+	X, Y, Width, Height int
+	// Physical size in millimeters, 0 when unknown
+	WidthMM, HeightMM int
+}
+
+// recordingPointer is an in-memory PointerBackend that logs every call.
+// The tests and input replay use it in place of the real pointer.
+type recordingPointer struct {
+	mu            sync.Mutex
+	x, y          int
+	width, height int
+	ops           []string
+}
+
+func newRecordingPointer(width, height int) *recordingPointer {
+	return &recordingPointer{width: width, height: height}
+}
+
+func (p *recordingPointer) Location() (int, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.x, p.y
+}
+
+func (p *recordingPointer) Move(x, y int) {
+	p.record("move %d,%d", x, y)
+	p.mu.Lock()
+	p.x, p.y = x, y
+	p.mu.Unlock()
+}
+
+func (p *recordingPointer) ScreenSize() (int, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.width, p.height
+}
+
+func (p *recordingPointer) Press(button MouseButton) {
+	p.record("press %v", button)
+}
+
+func (p *recordingPointer) Release(button MouseButton) {
+	p.record("release %v", button)
+}
+
+func (p *recordingPointer) Click(button MouseButton) {
+	p.record("click %v", button)
+}
+
+func (p *recordingPointer) Scroll(x, y int) {
+	p.record("scroll %d,%d", x, y)
+}
+
+func (p *recordingPointer) record(format string, args ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ops = append(p.ops, fmt.Sprintf(format, args...))
+}
+
+// Ops returns the calls made so far, such as "press left" or "move 10,20"
+func (p *recordingPointer) Ops() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.ops...)
+}
@@ -0,0 +1,71 @@
+package main
+
+import "github.com/go-vgo/robotgo"
+
+// robotgoPointer drives the local display through robotgo
+type robotgoPointer struct{}
+
+func (robotgoPointer) Location() (int, int) {
+	return robotgo.Location()
+}
+
+func (robotgoPointer) Move(x, y int) {
+	robotgo.Move(x, y)
+}
+
+func (robotgoPointer) ScreenSize() (int, int) {
+	return robotgo.GetScreenSize()
+}
+
+// Monitors returns the displays robotgo knows, without their physical size
+func (robotgoPointer) Monitors() []Monitor {
+	var monitors []Monitor
+	for i := 0; i < robotgo.DisplaysNum(); i++ {
+		x, y, w, h := robotgo.GetDisplayBounds(i)
+		monitors = append(monitors, Monitor{X: x, Y: y, Width: w, Height: h})
+	}
+	return monitors
+}
+
+func (robotgoPointer) Press(button MouseButton) {
+	if name, ok := robotgoButton(button); ok {
+		robotgo.Toggle(name, "down")
+	} else {
+		robotgoExtraButton(button, true)
+	}
+}
+
+func (robotgoPointer) Release(button MouseButton) {
+	if name, ok := robotgoButton(button); ok {
+		robotgo.Toggle(name, "up")
+	} else {
+		robotgoExtraButton(button, false)
+	}
+}
+
+func (p robotgoPointer) Click(button MouseButton) {
+	if name, ok := robotgoButton(button); ok {
+		robotgo.Click(name, false)
+	} else {
+		p.Press(button)
+		p.Release(button)
+	}
+}
+
+func (robotgoPointer) Scroll(x, y int) {
+	robotgoScroll(x, y)
+}
+
+// robotgoButton returns robotgo's name for a button; it only knows the first three
+func robotgoButton(button MouseButton) (string, bool) {
+	switch button {
+	case ButtonLeft:
+		return "left", true
+	case ButtonRight:
+		return "right", true
+	case ButtonMiddle:
+		return "center", true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,42 @@
+//go:build darwin
+
+package main
+
+/*
+#cgo LDFLAGS: -framework CoreGraphics -framework CoreFoundation
+
+#include <CoreGraphics/CoreGraphics.h>
+
+static void postOtherButton(int button, int down) {
+    CGEventRef here = CGEventCreate(NULL);
+    CGPoint location = CGEventGetLocation(here);
+    CFRelease(here);
+
+    CGEventType type = down ? kCGEventOtherMouseDown : kCGEventOtherMouseUp;
+    CGEventRef event = CGEventCreateMouseEvent(NULL, type, location, (CGMouseButton)button);
+    CGEventPost(kCGHIDEventTap, event);
+    CFRelease(event);
+}
+*/
+import "C"
+
+import "github.com/go-vgo/robotgo"
+
+// macScrollPixels is how far one notch scrolls; robotgo scrolls in pixels on macOS
+const macScrollPixels = 10
+
+// robotgoScroll scrolls by x, y notches. A positive horizontal wheel
+// value scrolls left on macOS.
+func robotgoScroll(x, y int) {
+	robotgo.Scroll(-x*macScrollPixels, y*macScrollPixels, 0)
+}
+
+// robotgoExtraButton presses or releases a button beyond the first three.
+// macOS numbers buttons from 0, and calls back and forward 3 and 4.
+func robotgoExtraButton(button MouseButton, press bool) {
+	down := 0
+	if press {
+		down = 1
+	}
+	C.postOtherButton(C.int(button-ButtonBack+3), C.int(down))
+}
@@ -0,0 +1,35 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/go-vgo/robotgo"
+)
+
+// robotgoScroll scrolls by x, y notches. robotgo clicks X button 6
+// (scroll left) for positive x.
+func robotgoScroll(x, y int) {
+	robotgo.Scroll(-x, y, 0)
+}
+
+// extraButtons is the XTest connection used for buttons robotgo can't press
+var extraButtons struct {
+	once    sync.Once
+	pointer *xtestPointer
+}
+
+// robotgoExtraButton presses or releases a button beyond the first three
+func robotgoExtraButton(button MouseButton, press bool) {
+	extraButtons.once.Do(func() {
+		var err error
+		if extraButtons.pointer, err = newXTestPointer(""); err != nil {
+			fmt.Printf("Extra mouse buttons unavailable: %v\n", err)
+		}
+	})
+	if extraButtons.pointer != nil {
+		extraButtons.pointer.fakeButton(x11Button(button), press)
+	}
+}
@@ -0,0 +1,63 @@
+//go:build windows
+
+package main
+
+import "unsafe"
+
+var procSendInput = user32.NewProc("SendInput")
+
+const (
+	INPUT_MOUSE        = 0
+	MOUSEEVENTF_XDOWN  = 0x0080
+	MOUSEEVENTF_XUP    = 0x0100
+	MOUSEEVENTF_WHEEL  = 0x0800
+	MOUSEEVENTF_HWHEEL = 0x1000
+	WHEEL_DELTA        = 120
+	XBUTTON1           = 1
+	XBUTTON2           = 2
+)
+
+// mouseInput is an INPUT holding a MOUSEINPUT; the union starts at pointer alignment
+type mouseInput struct {
+	Type        uint32
+	_           [unsafe.Sizeof(uintptr(0)) - 4]byte
+	Dx          int32
+	Dy          int32
+	MouseData   uint32
+	DwFlags     uint32
+	Time        uint32
+	DwExtraInfo uintptr
+}
+
+// robotgoScroll scrolls by x, y notches. It sends the wheel input itself,
+// because robotgo turns horizontal scrolling into vertical on Windows.
+func robotgoScroll(x, y int) {
+	var inputs []mouseInput
+	if y != 0 {
+		inputs = append(inputs, mouseInput{Type: INPUT_MOUSE, DwFlags: MOUSEEVENTF_WHEEL, MouseData: uint32(int32(y * WHEEL_DELTA))})
+	}
+	if x != 0 {
+		inputs = append(inputs, mouseInput{Type: INPUT_MOUSE, DwFlags: MOUSEEVENTF_HWHEEL, MouseData: uint32(int32(x * WHEEL_DELTA))})
+	}
+	if len(inputs) > 0 {
+		procSendInput.Call(uintptr(len(inputs)), uintptr(unsafe.Pointer(&inputs[0])), unsafe.Sizeof(inputs[0]))
+	}
+}
+
+// robotgoExtraButton presses or releases a button beyond the first three.
+// Windows only has two of them, back and forward.
+func robotgoExtraButton(button MouseButton, press bool) {
+	input := mouseInput{Type: INPUT_MOUSE, DwFlags: MOUSEEVENTF_XUP}
+	if press {
+		input.DwFlags = MOUSEEVENTF_XDOWN
+	}
+	switch button {
+	case ButtonBack:
+		input.MouseData = XBUTTON1
+	case ButtonForward:
+		input.MouseData = XBUTTON2
+	default:
+		return
+	}
+	procSendInput.Call(1, uintptr(unsafe.Pointer(&input)), unsafe.Sizeof(input))
+}
@@ -0,0 +1,174 @@
+//go:build linux
+
+package main
+
+// uinputMouse is a PointerBackend that sends relative motion, buttons and
+// wheel events through a virtual /dev/uinput mouse. Every compositor accepts
+// it, including Wayland ones where robotgo can't move the pointer.
+// The pointer position can't be read back, so Location reports zero.
+// Move warps through the optional tablet and does nothing without it.
+type uinputMouse struct {
+	dev    *uinputDevice
+	tablet *uinputTablet
+
+	wheel, hwheel hiResWheel
+}
+
+func newUinputMouse() (*uinputMouse, error) {
+	dev, err := createUinputDevice(uinputNamePrefix+" virtual mouse", uinputProductMouse, uinputCapabilities{
+		keys: []uint16{BTN_LEFT, BTN_RIGHT, BTN_MIDDLE, BTN_SIDE, BTN_EXTRA, BTN_FORWARD, BTN_BACK, BTN_TASK},
+		rels: []uint16{REL_X, REL_Y, REL_WHEEL, REL_HWHEEL, REL_WHEEL_HI_RES, REL_HWHEEL_HI_RES},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &uinputMouse{dev: dev}, nil
+}
+
+func (m *uinputMouse) Location() (int, int) {
+	return 0, 0
+}
+
+func (m *uinputMouse) Move(x, y int) {
+	if m.tablet != nil {
+		m.tablet.warp(x, y)
+	}
+}
+
+func (m *uinputMouse) ScreenSize() (int, int) {
+	if m.tablet != nil {
+		return m.tablet.width, m.tablet.height
+	}
+	return 0, 0
+}
+
+func (m *uinputMouse) MoveRelative(dx, dy int) {
+	if dx != 0 {
+		m.dev.emit(EV_REL, REL_X, int32(dx))
+	}
+	if dy != 0 {
+		m.dev.emit(EV_REL, REL_Y, int32(dy))
+	}
+	m.dev.syn()
+}
+
+func (m *uinputMouse) Press(button MouseButton) {
+	m.dev.emit(EV_KEY, uinputButton(button), 1)
+	m.dev.syn()
+}
+
+func (m *uinputMouse) Release(button MouseButton) {
+	m.dev.emit(EV_KEY, uinputButton(button), 0)
+	m.dev.syn()
+}
+
+func (m *uinputMouse) Click(button MouseButton) {
+	m.Press(button)
+	m.Release(button)
+}
+
+func (m *uinputMouse) Scroll(x, y int) {
+	m.ScrollHighRes(float64(x), float64(y))
+}
+
+// ScrollHighRes sends REL_*_HI_RES events, together with whole-notch
+// REL_WHEEL / REL_HWHEEL events for clients that only read those
+func (m *uinputMouse) ScrollHighRes(x, y float64) {
+	if hiRes, notches := m.wheel.add(y); hiRes != 0 {
+		m.dev.emit(EV_REL, REL_WHEEL_HI_RES, hiRes)
+		if notches != 0 {
+			m.dev.emit(EV_REL, REL_WHEEL, notches)
+		}
+	}
+	if hiRes, notches := m.hwheel.add(x); hiRes != 0 {
+		m.dev.emit(EV_REL, REL_HWHEEL_HI_RES, hiRes)
+		if notches != 0 {
+			m.dev.emit(EV_REL, REL_HWHEEL, notches)
+		}
+	}
+	m.dev.syn()
+}
+
+// Close destroys the virtual devices
+func (m *uinputMouse) Close() error {
+	if m.tablet != nil {
+		m.tablet.dev.Close()
+	}
+	return m.dev.Close()
+}
+
+// hiResUnits is the REL_*_HI_RES value of one notch
+const hiResUnits = 120
+
+// hiResWheel splits scrolling into hi-res units and whole notches the same
+// way a high-resolution wheel reports them
+type hiResWheel struct {
+	fraction float64 // Below one hi-res unit, not sent yet
+	partial  int32   // Hi-res units sent since the last whole notch
+}
+
+// add takes a scroll amount in notches and returns what to send
+func (w *hiResWheel) add(amount float64) (hiRes, notches int32) {
+	w.fraction += amount * hiResUnits
+	hiRes = int32(w.fraction)
+	w.fraction -= float64(hiRes)
+
+	w.partial += hiRes
+	notches = w.partial / hiResUnits
+	w.partial -= notches * hiResUnits
+	return hiRes, notches
+}
+
+// uinputButton returns the evdev code for a button. Past the first three
+// they follow the order X servers number evdev buttons in: BTN_SIDE is 8
+// (back), BTN_EXTRA 9 (forward), then BTN_FORWARD, BTN_BACK and BTN_TASK.
+func uinputButton(button MouseButton) uint16 {
+	switch button {
+	case ButtonRight:
+		return BTN_RIGHT
+	case ButtonMiddle:
+		return BTN_MIDDLE
+	case ButtonLeft:
+		return BTN_LEFT
+	default:
+		return BTN_SIDE + uint16(button-ButtonBack)
+	}
+}
+
+// uinputTablet is a virtual screen tablet spanning the whole screen layout.
+// Warping with it lands on the exact pixel, since compositors apply no
+// pointer acceleration to absolute devices.
+type uinputTablet struct {
+	dev           *uinputDevice
+	width, height int
+}
+
+// uinputTabletResolution is the tablet's units per millimeter, about 96 DPI
+const uinputTabletResolution = 4
+
+func newUinputTablet(width, height int) (*uinputTablet, error) {
+	dev, err := createUinputDevice(uinputNamePrefix+" virtual tablet", uinputProductTablet, uinputCapabilities{
+		keys: []uint16{BTN_TOOL_PEN},
+		// libinput ignores tablets without a resolution
+		abs: []uinputAxis{
+			{code: ABS_X, max: int32(width - 1), resolution: uinputTabletResolution},
+			{code: ABS_Y, max: int32(height - 1), resolution: uinputTabletResolution},
+		},
+		props: []uint16{INPUT_PROP_DIRECT},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &uinputTablet{dev: dev, width: width, height: height}, nil
+}
+
+// warp moves the pointer to a screen position by bringing the pen into
+// proximity there and taking it away again
+func (t *uinputTablet) warp(x, y int) {
+	t.dev.emit(EV_KEY, BTN_TOOL_PEN, 1)
+	t.dev.emit(EV_ABS, ABS_X, int32(x))
+	t.dev.emit(EV_ABS, ABS_Y, int32(y))
+	t.dev.syn()
+	t.dev.emit(EV_KEY, BTN_TOOL_PEN, 0)
+	t.dev.syn()
+}
@@ -0,0 +1,189 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/randr"
+	"github.com/jezek/xgb/xproto"
+	"github.com/jezek/xgb/xtest"
+)
+
+// xtestResyncIdle is how long the pointer has to sit still before we ask
+// the X server where it is again, and xtestResyncHeld how often we ask while
+// it keeps moving
+const (
+	xtestResyncIdle = 100 * time.Millisecond
+	xtestResyncHeld = 250 * time.Millisecond
+)
+
+// xtestPointer is a PointerBackend that sends XTest requests over its own X
+// connection. None of them waits for a reply and the position is tracked
+// locally, so most ticks cost no round-trip. The real position is queried
+// again after the pointer sat still, and every xtestResyncHeld during a long
+// hold, so a physical mouse moved meanwhile isn't undone for long. XInput2 raw
+// motion would say so exactly, but xgb can't read the generic events XInput2
+// sends.
+type xtestPointer struct {
+	mu            sync.Mutex
+	conn          *xgb.Conn
+	root          xproto.Window
+	width, height int
+	screen        Monitor // The whole screen, used without RandR
+	randr         bool
+
+	x, y      int
+	lastMove  time.Time
+	lastQuery time.Time
+}
+
+// newXTestPointer connects to the given X display ("" uses $DISPLAY)
+func newXTestPointer(display string) (*xtestPointer, error) {
+	conn, err := xgb.NewConnDisplay(display)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to X display: %v", err)
+	}
+	if err := xtest.Init(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("XTest extension unavailable: %v", err)
+	}
+
+	screen := xproto.Setup(conn).DefaultScreen(conn)
+	p := &xtestPointer{
+		conn:   conn,
+		root:   screen.Root,
+		width:  int(screen.WidthInPixels),
+		height: int(screen.HeightInPixels),
+		screen: Monitor{
+			Width:    int(screen.WidthInPixels),
+			Height:   int(screen.HeightInPixels),
+			WidthMM:  int(screen.WidthInMillimeters),
+			HeightMM: int(screen.HeightInMillimeters),
+		},
+		randr: randr.Init(conn) == nil,
+	}
+
+	// Nothing is selected on this connection, but request errors still
+	// arrive as events and must be drained
+	go func() {
+		for {
+			if ev, err := conn.WaitForEvent(); ev == nil && err == nil {
+				return
+			}
+		}
+	}()
+	return p, nil
+}
+
+func (p *xtestPointer) Location() (int, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if time.Since(p.lastMove) >= xtestResyncIdle || time.Since(p.lastQuery) >= xtestResyncHeld {
+		if reply, err := xproto.QueryPointer(p.conn, p.root).Reply(); err == nil {
+			p.x, p.y = int(reply.RootX), int(reply.RootY)
+		}
+		p.lastQuery = time.Now()
+	}
+	return p.x, p.y
+}
+
+func (p *xtestPointer) Move(x, y int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lastMove = time.Now()
+	if x == p.x && y == p.y {
+		return // Pinned against a screen edge
+	}
+	p.x, p.y = x, y
+	xtest.FakeInput(p.conn, xproto.MotionNotify, 0, 0, p.root, int16(x), int16(y), 0)
+}
+
+func (p *xtestPointer) ScreenSize() (int, int) {
+	return p.width, p.height
+}
+
+func (p *xtestPointer) Press(button MouseButton) {
+	p.fakeButton(x11Button(button), true)
+}
+
+func (p *xtestPointer) Release(button MouseButton) {
+	p.fakeButton(x11Button(button), false)
+}
+
+func (p *xtestPointer) Click(button MouseButton) {
+	p.fakeButton(x11Button(button), true)
+	p.fakeButton(x11Button(button), false)
+}
+
+// Scroll clicks the X wheel buttons: 4 and 5 scroll up and down, 6 and 7 left and right
+func (p *xtestPointer) Scroll(x, y int) {
+	clicks := func(n int, positive, negative byte) {
+		button := positive
+		if n < 0 {
+			button, n = negative, -n
+		}
+		for ; n > 0; n-- {
+			p.fakeButton(button, true)
+			p.fakeButton(button, false)
+		}
+	}
+	clicks(y, 4, 5)
+	clicks(x, 7, 6)
+}
+
+func (p *xtestPointer) fakeButton(button byte, press bool) {
+	kind := byte(xproto.ButtonRelease)
+	if press {
+		kind = xproto.ButtonPress
+	}
+	xtest.FakeInput(p.conn, kind, button, 0, p.root, 0, 0, 0)
+}
+
+// Monitors returns the enabled RandR outputs with their physical size
+func (p *xtestPointer) Monitors() []Monitor {
+	if !p.randr {
+		return []Monitor{p.screen}
+	}
+	res, err := randr.GetScreenResourcesCurrent(p.conn, p.root).Reply()
+	if err != nil {
+		return []Monitor{p.screen}
+	}
+
+	var monitors []Monitor
+	for _, output := range res.Outputs {
+		info, err := randr.GetOutputInfo(p.conn, output, res.ConfigTimestamp).Reply()
+		if err != nil || info.Connection != randr.ConnectionConnected || info.Crtc == 0 {
+			continue
+		}
+		crtc, err := randr.GetCrtcInfo(p.conn, info.Crtc, res.ConfigTimestamp).Reply()
+		if err != nil {
+			continue
+		}
+		monitors = append(monitors, Monitor{
+			X:        int(crtc.X),
+			Y:        int(crtc.Y),
+			Width:    int(crtc.Width),
+			Height:   int(crtc.Height),
+			WidthMM:  int(info.MmWidth),
+			HeightMM: int(info.MmHeight),
+		})
+	}
+	return monitors
+}
+
+// Close drops the X connection
+func (p *xtestPointer) Close() error {
+	p.conn.Close()
+	return nil
+}
+
+// x11Button returns the X button number for a button
+func x11Button(button MouseButton) byte {
+	return byte(button)
+}
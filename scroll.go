@@ -0,0 +1,15 @@
+package main
+
+import "math"
+
+// scrollKeyRate returns the scroll rate in notches per second after a scroll
+// key has been held for the given number of seconds. It eases in from
+// InitialSpeed to Speed over RampTime, so short holds stay controllable.
+func scrollKeyRate(held float64, cfg ScrollConfig) float64 {
+	ramp := cfg.RampTime / 1000
+	if ramp <= 0 || held >= ramp {
+		return cfg.Speed
+	}
+	t := math.Max(held, 0) / ramp
+	return cfg.InitialSpeed + (cfg.Speed-cfg.InitialSpeed)*t*t
+}
@@ -0,0 +1,262 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// uinput ioctls from <linux/uinput.h>
+var (
+	uiDevCreate  = ioc(iocNone, 'U', 1, 0)
+	uiDevDestroy = ioc(iocNone, 'U', 2, 0)
+	uiDevSetup   = ioc(iocWrite, 'U', 3, unsafe.Sizeof(uinputSetup{}))
+	uiAbsSetup   = ioc(iocWrite, 'U', 4, unsafe.Sizeof(uinputAbsSetup{}))
+	uiSetEvBit   = ioc(iocWrite, 'U', 100, 4)
+	uiSetKeyBit  = ioc(iocWrite, 'U', 101, 4)
+	uiSetRelBit  = ioc(iocWrite, 'U', 102, 4)
+	uiSetAbsBit  = ioc(iocWrite, 'U', 103, 4)
+	uiSetMscBit  = ioc(iocWrite, 'U', 104, 4)
+	uiSetLedBit  = ioc(iocWrite, 'U', 105, 4)
+	uiSetPropBit = ioc(iocWrite, 'U', 110, 4)
+)
+
+// Event types and codes used by the virtual devices
+const (
+	EV_SYN = 0
+	EV_REL = 2
+	EV_MSC = 4
+	EV_LED = 0x11
+
+	SYN_REPORT = 0
+	MSC_SCAN   = 4
+
+	REL_X             = 0x00
+	REL_Y             = 0x01
+	REL_HWHEEL        = 0x06
+	REL_WHEEL         = 0x08
+	REL_WHEEL_HI_RES  = 0x0b
+	REL_HWHEEL_HI_RES = 0x0c
+
+	BTN_LEFT     = 0x110
+	BTN_RIGHT    = 0x111
+	BTN_MIDDLE   = 0x112
+	BTN_SIDE     = 0x113
+	BTN_EXTRA    = 0x114
+	BTN_FORWARD  = 0x115
+	BTN_BACK     = 0x116
+	BTN_TASK     = 0x117
+	BTN_TOOL_PEN = 0x140
+
+	INPUT_PROP_DIRECT = 0x01
+)
+
+const (
+	uinputPath          = "/dev/uinput"
+	uinputNameSize      = 80
+	uinputAbsCount      = 64
+	busVirtual          = 0x06
+	uinputVendor        = 0x6d6b // "mk"
+	uinputProductKbd    = 0x0001
+	uinputProductMouse  = 0x0002
+	uinputProductTablet = 0x0003
+)
+
+// uinputNamePrefix marks our own virtual devices so the hook never reads them back
+const uinputNamePrefix = "mousekeys"
+
+// uinputCapabilities lists the event codes a virtual device advertises
+type uinputCapabilities struct {
+	keys  []uint16
+	rels  []uint16
+	abs   []uinputAxis
+	msc   []uint16
+	leds  []uint16
+	props []uint16
+}
+
+// uinputAxis is an absolute axis, its range and its resolution in units per
+// millimeter
+type uinputAxis struct {
+	code       uint16
+	min, max   int32
+	resolution int32
+}
+
+// uinputSetup mirrors struct uinput_setup
+type uinputSetup struct {
+	ID           inputID
+	Name         [uinputNameSize]byte
+	FFEffectsMax uint32
+}
+
+// uinputAbsSetup mirrors struct uinput_abs_setup
+type uinputAbsSetup struct {
+	Code uint16
+	_    uint16
+	Info absInfo
+}
+
+// uinputDevice is a virtual input device created through /dev/uinput
+type uinputDevice struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// createUinputDevice registers a new virtual device with the given capabilities
+func createUinputDevice(name string, product uint16, caps uinputCapabilities) (*uinputDevice, error) {
+	f, err := os.OpenFile(uinputPath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", uinputPath, err)
+	}
+
+	setBits := func(evType uint16, req uintptr, codes []uint16) error {
+		if len(codes) == 0 {
+			return nil
+		}
+		if err := ioctl(f, uiSetEvBit, uintptr(evType)); err != nil {
+			return err
+		}
+		for _, code := range codes {
+			if err := ioctl(f, req, uintptr(code)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err = ioctl(f, uiSetEvBit, EV_SYN)
+	if err == nil {
+		err = setBits(EV_KEY, uiSetKeyBit, caps.keys)
+	}
+	if err == nil {
+		err = setBits(EV_REL, uiSetRelBit, caps.rels)
+	}
+	if err == nil {
+		var codes []uint16
+		for _, axis := range caps.abs {
+			codes = append(codes, axis.code)
+		}
+		err = setBits(EV_ABS, uiSetAbsBit, codes)
+	}
+	if err == nil {
+		err = setBits(EV_MSC, uiSetMscBit, caps.msc)
+	}
+	if err == nil {
+		err = setBits(EV_LED, uiSetLedBit, caps.leds)
+	}
+	for _, prop := range caps.props {
+		if err == nil {
+			err = ioctl(f, uiSetPropBit, uintptr(prop))
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to configure uinput device: %v", err)
+	}
+
+	if err := setupUinputDevice(f, name, product, caps.abs); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write uinput device description: %v", err)
+	}
+
+	if err := ioctl(f, uiDevCreate, 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to create uinput device: %v", err)
+	}
+
+	return &uinputDevice{file: f}, nil
+}
+
+// setupUinputDevice describes the device with UI_DEV_SETUP and its axes with
+// UI_ABS_SETUP. Only these can set an axis resolution, which libinput needs
+// to accept a tablet; kernels before 4.5 get the legacy struct uinput_user_dev.
+func setupUinputDevice(f *os.File, name string, product uint16, axes []uinputAxis) error {
+	id := inputID{Bustype: busVirtual, Vendor: uinputVendor, Product: product, Version: 1}
+
+	setup := uinputSetup{ID: id}
+	copy(setup.Name[:uinputNameSize-1], name)
+	err := ioctl(f, uiDevSetup, uintptr(unsafe.Pointer(&setup)))
+	if errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTTY) {
+		return writeLegacyUinputDevice(f, name, id, axes)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, axis := range axes {
+		abs := uinputAbsSetup{Code: axis.code, Info: absInfo{Minimum: axis.min, Maximum: axis.max, Resolution: axis.resolution}}
+		if err := ioctl(f, uiAbsSetup, uintptr(unsafe.Pointer(&abs))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeLegacyUinputDevice describes the device by writing struct
+// uinput_user_dev: name, input_id, ff_effects_max, absmax/absmin/absfuzz/absflat
+func writeLegacyUinputDevice(f *os.File, name string, id inputID, axes []uinputAxis) error {
+	buf := make([]byte, uinputNameSize+8+4+4*uinputAbsCount*4)
+	copy(buf[:uinputNameSize-1], name)
+	binary.NativeEndian.PutUint16(buf[uinputNameSize:], id.Bustype)
+	binary.NativeEndian.PutUint16(buf[uinputNameSize+2:], id.Vendor)
+	binary.NativeEndian.PutUint16(buf[uinputNameSize+4:], id.Product)
+	binary.NativeEndian.PutUint16(buf[uinputNameSize+6:], id.Version)
+	absMax := uinputNameSize + 8 + 4
+	absMin := absMax + 4*uinputAbsCount
+	for _, axis := range axes {
+		binary.NativeEndian.PutUint32(buf[absMax+4*int(axis.code):], uint32(axis.max))
+		binary.NativeEndian.PutUint32(buf[absMin+4*int(axis.code):], uint32(axis.min))
+	}
+	_, err := f.Write(buf)
+	return err
+}
+
+// emit writes a single event to the virtual device
+func (d *uinputDevice) emit(evType, code uint16, value int32) error {
+	// The kernel stamps injected events itself, so the time is left zero
+	buf := make([]byte, inputEventSize)
+	encodeInputEvent(buf, inputEventSize, InputEvent{Type: evType, Code: code, Value: value})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, err := d.file.Write(buf)
+	return err
+}
+
+// syn flushes the events emitted so far as one report
+func (d *uinputDevice) syn() error {
+	return d.emit(EV_SYN, SYN_REPORT, 0)
+}
+
+// Read returns events the system sends to the device, such as LED changes
+func (d *uinputDevice) Read(buf []byte) (int, error) {
+	return d.file.Read(buf)
+}
+
+// Close destroys the virtual device
+func (d *uinputDevice) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ioctl(d.file, uiDevDestroy, 0)
+	return d.file.Close()
+}
+
+// keyboardKeyCodes returns every KEY_* code a keyboard may send.
+// BTN_* codes are left out so the device is not mistaken for a mouse or joystick.
+func keyboardKeyCodes() []uint16 {
+	var codes []uint16
+	for code := uint16(1); code < 0x100; code++ {
+		codes = append(codes, code)
+	}
+	for code := uint16(0x160); code < 0x2c0; code++ {
+		codes = append(codes, code)
+	}
+	return codes
+}